@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
 	"log"
+	"log/slog"
 	"maps"
 	"os"
+	"os/signal"
 	"slices"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/alexflint/go-arg"
@@ -13,7 +18,10 @@ import (
 	"github.com/b1naryth1ef/yamon/collector"
 	"github.com/b1naryth1ef/yamon/common"
 	"github.com/b1naryth1ef/yamon/journal"
+	"github.com/b1naryth1ef/yamon/probe"
 	"github.com/b1naryth1ef/yamon/prom"
+	"github.com/b1naryth1ef/yamon/statsd"
+	"github.com/b1naryth1ef/yamon/syslog"
 )
 
 func main() {
@@ -25,6 +33,9 @@ func main() {
 
 	yamon.SetupLogging(args.LogLevel)
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	config, err := common.LoadDaemonConfig(args.ConfigPath)
 	if err != nil {
 		log.Panicf("Failed to load configuration: %v", err)
@@ -49,7 +60,14 @@ func main() {
 		Interval:        time.Second * 5,
 	})
 
-	sink := yamon.NewSinkMetadataFilter(hostname, nil, forwardClientSink)
+	metadataSink := yamon.NewSinkMetadataFilter(hostname, nil, forwardClientSink)
+
+	sink, err := yamon.NewLogMetricFilter(config.LogMetrics, config.LogMetricInterval, metadataSink)
+	if err != nil {
+		log.Panicf("Failed to setup log metrics: %v", err)
+		return
+	}
+	go sink.Run()
 
 	if config.Journal != nil && config.Journal.Enabled {
 		err = journal.Run(config.Journal, sink)
@@ -64,16 +82,63 @@ func main() {
 		go httpServer.Run(config.HTTP.Bind)
 	}
 
+	for idx := range config.Syslog {
+		server := syslog.NewServer(&config.Syslog[idx], sink)
+		err = server.Start()
+		if err != nil {
+			log.Panicf("Failed to start syslog server: %v", err)
+			return
+		}
+	}
+
+	for idx := range config.Statsd {
+		server, err := statsd.NewServer(&config.Statsd[idx], sink)
+		if err != nil {
+			log.Panicf("Failed to setup statsd server: %v", err)
+			return
+		}
+		err = server.Start()
+		if err != nil {
+			log.Panicf("Failed to start statsd server: %v", err)
+			return
+		}
+	}
+
+	for idx := range config.Probes {
+		p, err := probe.New(&config.Probes[idx])
+		if err != nil {
+			log.Panicf("Failed to setup probe: %v", err)
+			return
+		}
+		go p.Run(ctx, sink)
+	}
+
+	var positions yamon.TailPositionStore = &yamon.NoopTailPositionStore{}
+	if config.LogFilePositionPath != "" {
+		store, err := yamon.NewFileBasedTailPositionStore(config.LogFilePositionPath, time.Second*5)
+		if err != nil {
+			log.Panicf("Failed to load log file positions: %v", err)
+			return
+		}
+		go store.Run()
+		positions = store
+	}
+
 	for _, logFile := range config.LogFile {
-		go yamon.RunTail(logFile, sink)
+		go yamon.RunTail(logFile, positions, sink)
 	}
 
+	var scripts sync.WaitGroup
 	for _, scriptConfig := range config.Scripts {
 		script, err := yamon.NewScript(scriptConfig)
 		if err != nil {
 			log.Panicf("Failed to setup script for path %v: %v", scriptConfig.Path, err)
 		}
-		go script.Run(sink)
+		scripts.Add(1)
+		go func() {
+			defer scripts.Done()
+			script.Run(ctx, sink)
+		}()
 	}
 
 	for _, promCfg := range config.Prometheus {
@@ -81,16 +146,20 @@ func main() {
 		if err != nil {
 			log.Panicf("Failed to setup prometheus scraper for url %v: %v", promCfg.URL, err)
 		}
-		go scraper.Run(sink)
+		go scraper.Run(ctx, sink)
 	}
 
-	collectors := make(map[string]common.CollectorConfig)
+	// every collector runs a default instance unless it is configured (or
+	// disabled) by a block without an instance label
+	type collectorKey struct{ name, instance string }
+	collectors := make(map[collectorKey]common.CollectorConfig)
 	for _, userCollector := range config.Collectors {
-		collectors[userCollector.Name] = userCollector
+		name := collector.Registry.Canonical(userCollector.Name)
+		collectors[collectorKey{name, userCollector.Instance}] = userCollector
 	}
 	for name := range collector.Registry {
-		if _, ok := collectors[name]; !ok {
-			collectors[name] = common.CollectorConfig{
+		if _, ok := collectors[collectorKey{name, ""}]; !ok {
+			collectors[collectorKey{name, ""}] = common.CollectorConfig{
 				Name: name,
 			}
 		}
@@ -100,10 +169,22 @@ func main() {
 		sink,
 		slices.Collect(maps.Values(collectors)),
 	)
-	producer.Start()
+	err = producer.Start()
+	if err != nil {
+		log.Panicf("Failed to start collectors: %v", err)
+		return
+	}
 
-	// TODO: catch signals + support "graceful" shutdown
-	for {
-		time.Sleep(time.Minute * 5)
+	<-ctx.Done()
+	slog.Info("yamon-agent: shutting down")
+
+	// kills any running scripts along with their children
+	scripts.Wait()
+
+	if store, ok := positions.(*yamon.FileBasedTailPositionStore); ok {
+		err = store.Sync()
+		if err != nil {
+			slog.Error("yamon-agent: failed to sync log file positions", slog.Any("error", err))
+		}
 	}
 }
@@ -25,6 +25,7 @@ var CLI struct {
 		Path      string   `arg:"" type:"path" help:"path of script to execute"`
 		Env       []string `name:"env" help:"configure env variables"`
 		Streaming bool     `name:"streaming" help:"enable streaming mode"`
+		Format    string   `name:"format" help:"output format of the script (json, ndjson, prometheus, influx or nagios)"`
 	} `cmd:"" help:"Run a yamon-compatible script and output the results."`
 
 	LogLevel string `name:"log-level" default:"info"`
@@ -67,23 +68,24 @@ func commandScript() error {
 		Path:      CLI.Script.Path,
 		Env:       env,
 		Streaming: CLI.Script.Streaming,
+		Format:    CLI.Script.Format,
 	})
 	if err != nil {
 		return err
 	}
 
-	return script.Execute(&FakeSink{})
+	return script.Execute(context.Background(), &FakeSink{})
 }
 
 func commandCollector() error {
-	collector := collector.Registry.Get(CLI.Collector.Name)
-	if collector == nil {
-		return fmt.Errorf("No collector with name '%s'\n", CLI.Collector.Name)
+	collector, err := collector.Registry.New(CLI.Collector.Name, "", nil)
+	if err != nil {
+		return fmt.Errorf("Error: %v\n", err)
 	}
 
 	start := time.Now()
 	sink := &FakeSink{}
-	err := collector.Collect(context.Background(), sink)
+	err = collector.Collect(context.Background(), sink)
 	if err != nil {
 		return fmt.Errorf("Error: %v\n", err)
 	}
@@ -0,0 +1,212 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/b1naryth1ef/yamon/common"
+	"github.com/hashicorp/hcl/v2"
+)
+
+type certsCollectorConfig struct {
+	// globs of PEM or DER encoded certificate files, every certificate of a
+	// bundle is reported
+	Files []string `hcl:"files,optional"`
+	// host:port endpoints, only the leaf certificate presented is reported
+	Endpoints []string `hcl:"endpoints,optional"`
+}
+
+type certChange struct {
+	Path     string    `json:"path"`
+	Index    int       `json:"index"`
+	Subject  string    `json:"subject"`
+	Serial   string    `json:"serial"`
+	Previous string    `json:"previous"`
+	NotAfter time.Time `json:"not_after"`
+}
+
+// parseCertificates reads all certificates from PEM data, falling back to DER
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 && !strings.Contains(string(data), "-----BEGIN") {
+		return x509.ParseCertificates(data)
+	}
+	return certs, nil
+}
+
+func certTags(cert *x509.Certificate, fields ...string) map[string]string {
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+
+	result := tags(fields...)
+	result["subject"] = certCommonName(cert.Subject.CommonName, cert.Subject.String())
+	result["issuer"] = certCommonName(cert.Issuer.CommonName, cert.Issuer.String())
+	result["serial"] = cert.SerialNumber.Text(16)
+	if len(sans) > 0 {
+		result["san"] = strings.Join(sans, ",")
+	}
+	return result
+}
+
+func certCommonName(commonName, name string) string {
+	if commonName != "" {
+		return commonName
+	}
+	return name
+}
+
+func writeCertExpiry(cert *x509.Certificate, now time.Time, sink common.MetricSink, tags map[string]string) {
+	sink.WriteMetric(common.NewGauge("certs.expiry_days", cert.NotAfter.Sub(now).Hours()/24, tags))
+}
+
+// certsCollector reports the expiry of certificates on disk and served by
+// remote endpoints, emitting an event whenever a certificate on disk is
+// replaced.
+type certsCollector struct {
+	config  certsCollectorConfig
+	serials map[string]string
+}
+
+func (c *certsCollector) Configure(body hcl.Body) error {
+	return decodeOptions(body, &c.config)
+}
+
+func (c *certsCollector) collectFiles(now time.Time, sink common.Sink) error {
+	var errs []error
+	seen := map[string]struct{}{}
+
+	for _, pattern := range c.config.Files {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			certs, err := parseCertificates(data)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", path, err))
+				continue
+			}
+
+			for idx, cert := range certs {
+				writeCertExpiry(cert, now, sink, certTags(cert, "path", path, "index", strconv.Itoa(idx)))
+
+				key := fmt.Sprintf("%s#%d", path, idx)
+				serial := cert.SerialNumber.Text(16)
+				seen[key] = struct{}{}
+
+				previous, ok := c.serials[key]
+				c.serials[key] = serial
+				if ok && previous != serial {
+					sink.WriteEvent(common.NewEventJSON("certs.changed", certChange{
+						Path:     path,
+						Index:    idx,
+						Subject:  certCommonName(cert.Subject.CommonName, cert.Subject.String()),
+						Serial:   serial,
+						Previous: previous,
+						NotAfter: cert.NotAfter,
+					}, map[string]string{"path": path}))
+				}
+			}
+		}
+	}
+
+	for key := range c.serials {
+		if _, ok := seen[key]; !ok {
+			delete(c.serials, key)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *certsCollector) collectEndpoint(ctx context.Context, endpoint string, now time.Time, sink common.Sink) error {
+	host, _, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return err
+	}
+
+	dialer := &tls.Dialer{
+		Config: &tls.Config{
+			ServerName: host,
+			// expired or otherwise invalid certificates still need reporting
+			InsecureSkipVerify: true,
+		},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", endpoint)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("%s: no certificates presented", endpoint)
+	}
+
+	cert := state.PeerCertificates[0]
+	writeCertExpiry(cert, now, sink, certTags(cert, "endpoint", endpoint))
+	return nil
+}
+
+func (c *certsCollector) Collect(ctx context.Context, sink common.Sink) error {
+	now := time.Now()
+
+	err := c.collectFiles(now, sink)
+	errs := []error{err}
+
+	for _, endpoint := range c.config.Endpoints {
+		err := c.collectEndpoint(ctx, endpoint, now, sink)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func init() {
+	Registry.Add("certs", Configured(func() Collector { return &certsCollector{serials: map[string]string{}} }))
+}
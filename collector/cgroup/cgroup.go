@@ -3,11 +3,14 @@ package cgroup
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	"github.com/b1naryth1ef/yamon/common"
 	"github.com/b1naryth1ef/yamon/util"
@@ -21,11 +24,13 @@ type deviceInfo struct {
 type CGroupCollector struct {
 	// todo: this can get stale?
 	deviceCache map[string]deviceInfo
+	containers  *containerResolver
 }
 
 func NewCGroupCollector() *CGroupCollector {
 	return &CGroupCollector{
 		deviceCache: map[string]deviceInfo{},
+		containers:  newContainerResolver(dockerSocketPath),
 	}
 }
 
@@ -34,10 +39,10 @@ func (c *CGroupCollector) Collect(ctx context.Context, sink common.Sink) error {
 		return fmt.Errorf("cgroup v1 not supported")
 	}
 
-	return c.collectGroup("/sys/fs/cgroup", sink)
+	return c.collectGroup(ctx, "/sys/fs/cgroup", sink)
 }
 
-func (c *CGroupCollector) collectGroup(path string, sink common.Sink) error {
+func (c *CGroupCollector) collectGroup(ctx context.Context, path string, sink common.Sink) error {
 	items, err := os.ReadDir(path)
 	if err != nil {
 		return err
@@ -50,11 +55,14 @@ func (c *CGroupCollector) collectGroup(path string, sink common.Sink) error {
 		"cgroup_path": cgroupPath,
 		"cgroup_name": cgroupName,
 	}
+	if container := c.containers.Resolve(ctx, cgroupPath); container != nil {
+		container.Tags(tags)
+	}
 
 	for _, item := range items {
 		itemPath := filepath.Join(path, item.Name())
 		if item.IsDir() {
-			err = c.collectGroup(itemPath, sink)
+			err = c.collectGroup(ctx, itemPath, sink)
 			if err != nil {
 				return err
 			}
@@ -69,6 +77,16 @@ func (c *CGroupCollector) collectGroup(path string, sink common.Sink) error {
 				err = collectFileStat("cgroup.memory.current", itemPath, tags, sink)
 			case "memory.swap.current":
 				err = collectFileStat("cgroup.memory.swap.current", itemPath, tags, sink)
+			case "memory.events":
+				err = collectFile("cgroup.memory.events", itemPath, tags, sink)
+			case "pids.current":
+				err = collectFileStat("cgroup.pids.current", itemPath, tags, sink)
+			case "cpu.pressure":
+				err = ignorePressureUnavailable(CollectPressure("cgroup.pressure.cpu", itemPath, tags, sink))
+			case "memory.pressure":
+				err = ignorePressureUnavailable(CollectPressure("cgroup.pressure.memory", itemPath, tags, sink))
+			case "io.pressure":
+				err = ignorePressureUnavailable(CollectPressure("cgroup.pressure.io", itemPath, tags, sink))
 			case "io.stat":
 				err = c.collectIOStat(itemPath, tags, sink)
 			}
@@ -107,7 +125,48 @@ func collectFileStat(name, path string, tags map[string]string, sink common.Sink
 		return err
 	}
 
-	sink.WriteMetric(common.NewGauge(name, util.ParseNumber(string(data)), tags))
+	sink.WriteMetric(common.NewGauge(name, util.ParseNumber(strings.TrimSpace(string(data))), tags))
+
+	return nil
+}
+
+// ignorePressureUnavailable ignores errors from reading pressure files when PSI
+// is disabled (psi=0 or cgroup.pressure=0) or the cgroup was just removed
+func ignorePressureUnavailable(err error) error {
+	if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+// full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func CollectPressure(base, path string, tags map[string]string, sink common.Sink) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		if len(line) == 0 {
+			return nil
+		}
+
+		parts := strings.Split(string(line), " ")
+		for _, part := range parts[1:] {
+			kv := strings.SplitN(part, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+
+			name := fmt.Sprintf("%s.%s.%s", base, parts[0], kv[0])
+			if kv[0] == "total" {
+				sink.WriteMetric(common.NewCounter(name, util.ParseNumber(kv[1]), tags))
+			} else {
+				sink.WriteMetric(common.NewGauge(name, util.ParseFloat(kv[1]), tags))
+			}
+		}
+	}
 
 	return nil
 }
@@ -0,0 +1,253 @@
+package cgroup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	containers "github.com/containerd/containerd/api/services/containers/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	containerRuntimeDocker     = "docker"
+	containerRuntimeContainerd = "containerd"
+
+	containerCacheTTL         = 5 * time.Minute
+	containerCacheNegativeTTL = 30 * time.Second
+
+	dockerSocketPath     = "/var/run/docker.sock"
+	containerdSocketPath = "/run/containerd/containerd.sock"
+)
+
+// namespaces searched (in order) when looking up a container in containerd
+var containerdNamespaces = []string{"k8s.io", "default"}
+
+// matches both the systemd (docker-<id>.scope) and cgroupfs (docker/<id>)
+// naming schemes used by the various runtimes
+var containerCGroupNames = []struct {
+	runtime string
+	re      *regexp.Regexp
+}{
+	{containerRuntimeDocker, regexp.MustCompile(`^docker-([0-9a-f]{64})\.scope$`)},
+	{containerRuntimeContainerd, regexp.MustCompile(`^(?:cri-containerd|nerdctl)-([0-9a-f]{64})\.scope$`)},
+}
+
+var containerCGroupParents = map[string]string{
+	"docker":     containerRuntimeDocker,
+	"containerd": containerRuntimeContainerd,
+}
+
+var containerIDRe = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+type containerInfo struct {
+	ID             string
+	Runtime        string
+	Name           string
+	Image          string
+	ComposeProject string
+	ComposeService string
+}
+
+func (c *containerInfo) Tags(tags map[string]string) {
+	tags["container_id"] = c.ID
+	tags["container_runtime"] = c.Runtime
+	if c.Name != "" {
+		tags["container_name"] = c.Name
+	}
+	if c.Image != "" {
+		tags["container_image"] = c.Image
+	}
+	if c.ComposeProject != "" {
+		tags["compose_project"] = c.ComposeProject
+	}
+	if c.ComposeService != "" {
+		tags["compose_service"] = c.ComposeService
+	}
+}
+
+type containerCacheEntry struct {
+	info    *containerInfo
+	expires time.Time
+}
+
+type containerResolver struct {
+	sync.Mutex
+
+	cache      map[string]containerCacheEntry
+	docker     http.Client
+	containerd *grpc.ClientConn
+}
+
+func newContainerResolver(dockerSocket string) *containerResolver {
+	return &containerResolver{
+		cache: map[string]containerCacheEntry{},
+		docker: http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", dockerSocket)
+				},
+			},
+		},
+	}
+}
+
+// parseContainerCGroup extracts the runtime and container id from a cgroup
+// path, returns an empty id if the cgroup does not belong to a container.
+func parseContainerCGroup(cgroupPath string) (string, string) {
+	parts := strings.Split(cgroupPath, "/")
+	name := parts[len(parts)-1]
+
+	for _, candidate := range containerCGroupNames {
+		match := candidate.re.FindStringSubmatch(name)
+		if match != nil {
+			return candidate.runtime, match[1]
+		}
+	}
+
+	if len(parts) >= 2 && containerIDRe.MatchString(name) {
+		if runtime, ok := containerCGroupParents[parts[len(parts)-2]]; ok {
+			return runtime, name
+		}
+	}
+
+	return "", ""
+}
+
+func (c *containerResolver) Resolve(ctx context.Context, cgroupPath string) *containerInfo {
+	runtime, id := parseContainerCGroup(cgroupPath)
+	if id == "" {
+		return nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	if entry, ok := c.cache[id]; ok && now.Before(entry.expires) {
+		return entry.info
+	}
+
+	var info *containerInfo
+	var err error
+	switch runtime {
+	case containerRuntimeDocker:
+		info, err = c.inspectDocker(ctx, id)
+	case containerRuntimeContainerd:
+		info, err = c.inspectContainerd(ctx, id)
+	}
+
+	ttl := containerCacheTTL
+	if err != nil {
+		slog.Debug(
+			"cgroup: failed to resolve container metadata",
+			slog.String("runtime", runtime),
+			slog.String("id", id),
+			slog.Any("error", err),
+		)
+		info = &containerInfo{ID: id, Runtime: runtime}
+		ttl = containerCacheNegativeTTL
+	}
+
+	for key, entry := range c.cache {
+		if now.After(entry.expires) {
+			delete(c.cache, key)
+		}
+	}
+	c.cache[id] = containerCacheEntry{info: info, expires: now.Add(ttl)}
+
+	return info
+}
+
+type dockerInspect struct {
+	ID     string `json:"Id"`
+	Name   string `json:"Name"`
+	Config struct {
+		Image  string            `json:"Image"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+}
+
+func (c *containerResolver) inspectDocker(ctx context.Context, id string) (*containerInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("http://docker/containers/%s/json", id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.docker.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("invalid status code %d", res.StatusCode)
+	}
+
+	var data dockerInspect
+	err = json.NewDecoder(res.Body).Decode(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &containerInfo{
+		ID:             id,
+		Runtime:        containerRuntimeDocker,
+		Name:           strings.TrimPrefix(data.Name, "/"),
+		Image:          data.Config.Image,
+		ComposeProject: data.Config.Labels["com.docker.compose.project"],
+		ComposeService: data.Config.Labels["com.docker.compose.service"],
+	}, nil
+}
+
+func (c *containerResolver) inspectContainerd(ctx context.Context, id string) (*containerInfo, error) {
+	if c.containerd == nil {
+		conn, err := grpc.NewClient(
+			"unix://"+containerdSocketPath,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		if err != nil {
+			return nil, err
+		}
+		c.containerd = conn
+	}
+
+	client := containers.NewContainersClient(c.containerd)
+
+	var lastErr error
+	for _, namespace := range containerdNamespaces {
+		nsCtx := metadata.AppendToOutgoingContext(ctx, "containerd-namespace", namespace)
+		res, err := client.Get(nsCtx, &containers.GetContainerRequest{ID: id})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		labels := res.Container.Labels
+		name := labels["io.kubernetes.container.name"]
+		if name == "" {
+			name = labels["nerdctl/name"]
+		}
+
+		return &containerInfo{
+			ID:             id,
+			Runtime:        containerRuntimeContainerd,
+			Name:           name,
+			Image:          res.Container.Image,
+			ComposeProject: labels["com.docker.compose.project"],
+			ComposeService: labels["com.docker.compose.service"],
+		}, nil
+	}
+
+	return nil, lastErr
+}
@@ -0,0 +1,114 @@
+package cgroup
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const testContainerID = "4f1c5ab8a3e2c1d0b9a8f7e6d5c4b3a2f1e0d9c8b7a6f5e4d3c2b1a0f9e8d7c6"
+
+func TestParseContainerCGroup(t *testing.T) {
+	cases := []struct {
+		path    string
+		runtime string
+		id      string
+	}{
+		{"/sys/fs/cgroup/system.slice/docker-" + testContainerID + ".scope", containerRuntimeDocker, testContainerID},
+		{"/sys/fs/cgroup/kubepods.slice/cri-containerd-" + testContainerID + ".scope", containerRuntimeContainerd, testContainerID},
+		{"/sys/fs/cgroup/docker/" + testContainerID, containerRuntimeDocker, testContainerID},
+		{"/sys/fs/cgroup/system.slice/sshd.service", "", ""},
+		{"/sys/fs/cgroup/other/" + testContainerID, "", ""},
+	}
+
+	for _, c := range cases {
+		runtime, id := parseContainerCGroup(c.path)
+		if runtime != c.runtime || id != c.id {
+			t.Errorf("parseContainerCGroup(%q) = %q, %q, want %q, %q", c.path, runtime, id, c.runtime, c.id)
+		}
+	}
+}
+
+// serveFakeDocker serves the container inspect endpoint of the docker api on
+// a unix socket
+func serveFakeDocker(t *testing.T, requests *atomic.Int32) string {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/containers/"+testContainerID+"/json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{
+			"Id": "` + testContainerID + `",
+			"Name": "/web-1",
+			"Config": {
+				"Image": "nginx:1.27",
+				"Labels": {"com.docker.compose.project": "shop", "com.docker.compose.service": "web"}
+			}
+		}`))
+	})}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	return socket
+}
+
+func TestResolveDockerContainer(t *testing.T) {
+	var requests atomic.Int32
+	resolver := newContainerResolver(serveFakeDocker(t, &requests))
+
+	path := "/sys/fs/cgroup/system.slice/docker-" + testContainerID + ".scope"
+	info := resolver.Resolve(context.Background(), path)
+	if info == nil {
+		t.Fatal("expected container info")
+	}
+
+	tags := map[string]string{}
+	info.Tags(tags)
+	expected := map[string]string{
+		"container_id":      testContainerID,
+		"container_runtime": containerRuntimeDocker,
+		"container_name":    "web-1",
+		"container_image":   "nginx:1.27",
+		"compose_project":   "shop",
+		"compose_service":   "web",
+	}
+	for k, v := range expected {
+		if tags[k] != v {
+			t.Errorf("tag %s = %q, want %q", k, tags[k], v)
+		}
+	}
+
+	// lookups are cached
+	resolver.Resolve(context.Background(), path)
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+}
+
+func TestResolveUnknownDockerContainer(t *testing.T) {
+	var requests atomic.Int32
+	resolver := newContainerResolver(serveFakeDocker(t, &requests))
+
+	id := strings.Repeat("a", 64)
+	info := resolver.Resolve(context.Background(), "/sys/fs/cgroup/system.slice/docker-"+id+".scope")
+	if info == nil || info.ID != id || info.Name != "" {
+		t.Fatalf("expected bare container info, got %+v", info)
+	}
+
+	if info := resolver.Resolve(context.Background(), "/sys/fs/cgroup/system.slice/sshd.service"); info != nil {
+		t.Fatalf("expected no container info, got %+v", info)
+	}
+}
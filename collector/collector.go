@@ -2,27 +2,109 @@ package collector
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/b1naryth1ef/yamon/collector/cgroup"
 	"github.com/b1naryth1ef/yamon/common"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
 )
 
-type registry map[string]Collector
+// Factory creates a new instance of a collector. instance is the (optional)
+// second label of the collector block and options holds the remaining body.
+type Factory func(instance string, options hcl.Body) (Collector, error)
+
+type registry map[string]Factory
 
 var Registry = registry{}
 
-func (r registry) Add(name string, collector Collector) {
-	r[name] = collector
+// aliases maps old collector names onto the collector replacing them, aliases
+// are not part of the registry so they don't run a default instance
+var aliases = map[string]string{}
+
+func (r registry) Add(name string, factory Factory) {
+	r[name] = factory
+}
+
+// Alias allows configuring the named collector under another (old) name
+func (r registry) Alias(alias, name string) {
+	aliases[alias] = name
+}
+
+// Canonical returns the name of the collector an alias refers to, other names
+// are returned unchanged
+func (r registry) Canonical(name string) string {
+	if target, ok := aliases[name]; ok {
+		return target
+	}
+	return name
+}
+
+func (r registry) Get(name string) Factory {
+	return r[r.Canonical(name)]
+}
+
+// New creates an instance of the named collector
+func (r registry) New(name, instance string, options hcl.Body) (Collector, error) {
+	factory, ok := r[r.Canonical(name)]
+	if !ok {
+		return nil, fmt.Errorf("no such collector '%s'", name)
+	}
+	return factory(instance, options)
 }
 
-func (r registry) Get(name string) Collector {
-	return r[name]
+// Configured returns a factory which creates collectors with fn, passing the
+// options to Configure for collectors implementing Configurable. Collectors
+// without options reject any that are given. fn is called for every configured
+// instance, so collectors keeping state must return a new collector each time.
+func Configured(fn func() Collector) Factory {
+	return func(instance string, options hcl.Body) (Collector, error) {
+		collector := fn()
+
+		configurable, ok := collector.(Configurable)
+		if !ok {
+			return collector, decodeOptions(options, &struct{}{})
+		}
+
+		err := configurable.Configure(options)
+		if err != nil {
+			return nil, err
+		}
+		return collector, nil
+	}
 }
 
 type Collector interface {
 	Collect(context.Context, common.Sink) error
 }
 
+// Configurable is implemented by collectors which accept additional options
+// within their collector block.
+type Configurable interface {
+	Configure(hcl.Body) error
+}
+
+// Periodic is implemented by collectors which are expensive to run and should
+// use a longer interval unless one is configured.
+type Periodic interface {
+	DefaultInterval() time.Duration
+}
+
+// decodeOptions decodes collector options into the target, a nil body leaves
+// the target untouched so that defaults can be set beforehand.
+func decodeOptions(body hcl.Body, target any) error {
+	if body == nil {
+		return nil
+	}
+
+	diags := gohcl.DecodeBody(body, nil, target)
+	if diags.HasErrors() {
+		return diags
+	}
+	return nil
+}
+
 type simpleCollector struct {
 	fn func(ctx context.Context, sink common.Sink) error
 }
@@ -31,9 +113,11 @@ func (s *simpleCollector) Collect(ctx context.Context, sink common.Sink) error {
 	return s.fn(ctx, sink)
 }
 
+// Simple registers a collector without options or state, every instance of it
+// is the returned collector
 func Simple(name string, fn func(ctx context.Context, sink common.Sink) error) Collector {
 	collector := &simpleCollector{fn: fn}
-	Registry.Add(name, collector)
+	Registry.Add(name, Configured(func() Collector { return collector }))
 	return collector
 }
 
@@ -48,5 +132,5 @@ func tags(fields ...string) map[string]string {
 }
 
 func init() {
-	Registry.Add("cgroup", cgroup.NewCGroupCollector())
+	Registry.Add("cgroup", Configured(func() Collector { return cgroup.NewCGroupCollector() }))
 }
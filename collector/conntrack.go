@@ -0,0 +1,32 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/b1naryth1ef/yamon/common"
+	"github.com/b1naryth1ef/yamon/util"
+)
+
+var conntrackCollector = Simple("conntrack", func(ctx context.Context, sink common.Sink) error {
+	count, err := os.ReadFile("/proc/sys/net/netfilter/nf_conntrack_count")
+	if err != nil {
+		// conntrack: module is not loaded
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	max, err := os.ReadFile("/proc/sys/net/netfilter/nf_conntrack_max")
+	if err != nil {
+		return err
+	}
+
+	sink.WriteMetric(common.NewGauge("conntrack.count", util.ParseNumber(strings.TrimSpace(string(count))), nil))
+	sink.WriteMetric(common.NewGauge("conntrack.max", util.ParseNumber(strings.TrimSpace(string(max))), nil))
+	return nil
+})
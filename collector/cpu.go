@@ -12,7 +12,7 @@ import (
 )
 
 var procStatCPUKeys = []string{
-	"user", "nice", "system", "idle", "iowait", "irq", "softirq",
+	"user", "nice", "system", "idle", "iowait", "irq", "softirq", "steal", "guest", "guest_nice",
 }
 
 var cpuCollector = Simple("cpu", func(ctx context.Context, sink common.Sink) error {
@@ -34,11 +34,19 @@ var cpuCollector = Simple("cpu", func(ctx context.Context, sink common.Sink) err
 			id := parts[0][3:]
 
 			for idx, key := range procStatCPUKeys {
+				// older kernels do not report steal/guest
+				if idx+1 >= len(parts) {
+					break
+				}
 				value := util.ParseNumber(parts[idx+1])
 				sink.WriteMetric(common.NewCounter(fmt.Sprintf("cpu.%s", key), value, map[string]string{"cpu": id}))
 			}
 		} else if parts[0] == "ctxt" {
 			sink.WriteMetric(common.NewCounter("cpu.ctxt", util.ParseNumber(parts[1]), nil))
+		} else if parts[0] == "intr" {
+			sink.WriteMetric(common.NewCounter("cpu.intr", util.ParseNumber(parts[1]), nil))
+		} else if parts[0] == "procs_running" || parts[0] == "procs_blocked" {
+			sink.WriteMetric(common.NewGauge(fmt.Sprintf("cpu.%s", parts[0]), util.ParseNumber(parts[1]), nil))
 		}
 	}
 
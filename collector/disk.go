@@ -5,14 +5,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
+	"log/slog"
 	"os"
-	"os/exec"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/b1naryth1ef/yamon/common"
 	"github.com/b1naryth1ef/yamon/util"
+	"github.com/hashicorp/hcl/v2"
+	"golang.org/x/sys/unix"
 )
 
 var statKeys = []string{
@@ -67,75 +71,305 @@ type DiskUsage struct {
 	FileSystemPath string
 	MountPath      string
 	Type           string
-	Inodes         uint64
-	IFree          uint64
-	IUsed          uint64
-	Avail          uint64
-	Used           uint64
+	Device         string
+	ReadOnly       bool
+	// sizes are in bytes, Free includes the blocks reserved for root while
+	// Avail is what unprivileged users may still use
+	Total    uint64
+	Free     uint64
+	Avail    uint64
+	Used     uint64
+	Reserved uint64
+	Inodes   uint64
+	IFree    uint64
+	IUsed    uint64
 }
 
-func getDiskUsage(ctx context.Context) ([]DiskUsage, error) {
-	cmd := exec.CommandContext(ctx, "/bin/df", "--output=source,target,fstype,file,itotal,iavail,iused,ipcent,size,avail,used,pcent")
-
-	var stdout bytes.Buffer
-	cmd.Stdout = &stdout
+type mountInfo struct {
+	Device    string
+	Root      string
+	MountPath string
+	Options   []string
+	Type      string
+	Source    string
+}
 
-	err := cmd.Run()
+// unescapes the octal sequences (\040 for spaces, etc) used in mountinfo paths
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, "\\") {
+		return path
+	}
 
-	var results []DiskUsage
-	for {
-		line, err := stdout.ReadString('\n')
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
+	var result strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if v, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				result.WriteByte(byte(v))
+				i += 3
+				continue
 			}
-			return nil, err
 		}
+		result.WriteByte(path[i])
+	}
+	return result.String()
+}
 
-		parts := util.FilterRepeatingSpaces(strings.Split(line, " "))
-		if parts[0] == "Filesystem" {
+// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+func getMounts() ([]mountInfo, error) {
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []mountInfo
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		parts := strings.Split(string(line), " ")
+		if len(parts) < 10 {
 			continue
 		}
 
-		usage := DiskUsage{
-			FileSystemPath: parts[0],
-			MountPath:      parts[1],
-			Type:           parts[2],
-			Inodes:         util.ParseNumber(parts[4]),
-			IFree:          util.ParseNumber(parts[5]),
-			IUsed:          util.ParseNumber(parts[6]),
-			Avail:          util.ParseNumber(parts[9]),
-			Used:           util.ParseNumber(parts[10]),
+		// optional fields are terminated by a single hyphen
+		sep := slices.Index(parts[6:], "-")
+		if sep == -1 || len(parts) < 6+sep+3 {
+			continue
 		}
-		results = append(results, usage)
+		sep += 6
+
+		result = append(result, mountInfo{
+			Device:    parts[2],
+			Root:      unescapeMountPath(parts[3]),
+			MountPath: unescapeMountPath(parts[4]),
+			Options:   strings.Split(parts[5], ","),
+			Type:      parts[sep+1],
+			Source:    unescapeMountPath(parts[sep+2]),
+		})
+	}
+
+	return result, nil
+}
+
+var errStatfsPending = errors.New("previous statfs has not returned yet")
+
+// statfs is run in a goroutine because it can block forever on unresponsive
+// network filesystems, a mount is skipped until its previous statfs returns so
+// that hung mounts don't pile up goroutines
+func (d *diskUsageCollector) statfs(ctx context.Context, path string) (*unix.Statfs_t, error) {
+	type result struct {
+		stat unix.Statfs_t
+		err  error
+	}
+
+	d.pendingLock.Lock()
+	if _, ok := d.pending[path]; ok {
+		d.pendingLock.Unlock()
+		return nil, errStatfsPending
+	}
+	d.pending[path] = struct{}{}
+	d.pendingLock.Unlock()
+
+	ch := make(chan result, 1)
+	go func() {
+		var res result
+		res.err = unix.Statfs(path, &res.stat)
+
+		d.pendingLock.Lock()
+		delete(d.pending, path)
+		d.pendingLock.Unlock()
+
+		ch <- res
+	}()
+
+	select {
+	case res := <-ch:
+		return &res.stat, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
+}
+
+var defaultDiskUsageExcludeTypes = []string{
+	"tmpfs", "devtmpfs", "sysfs", "proc", "devpts", "cgroup", "cgroup2",
+	"mqueue", "debugfs", "tracefs", "securityfs", "pstore", "bpf", "configfs",
+	"fusectl", "hugetlbfs", "autofs", "binfmt_misc", "nsfs", "rpc_pipefs",
+	"overlay", "squashfs",
+}
+
+var defaultDiskUsageExcludeMounts = []string{"overlay2"}
+
+type diskUsageCollectorConfig struct {
+	ExcludeTypes []string `hcl:"exclude_types,optional"`
+	// regular expressions matched against the mount path
+	ExcludeMounts []string `hcl:"exclude_mounts,optional"`
+}
+
+type diskUsageCollector struct {
+	excludeTypes  map[string]struct{}
+	excludeMounts []*regexp.Regexp
+
+	pendingLock sync.Mutex
+	pending     map[string]struct{}
+}
 
-	return results, err
+func newDiskUsageCollector() *diskUsageCollector {
+	collector := &diskUsageCollector{pending: map[string]struct{}{}}
+	err := collector.Configure(nil)
+	if err != nil {
+		panic(err)
+	}
+	return collector
 }
 
-var diskUsageCollector = Simple("disk_usage", func(ctx context.Context, sink common.Sink) error {
-	usage, err := getDiskUsage(ctx)
+func (d *diskUsageCollector) Configure(body hcl.Body) error {
+	config := diskUsageCollectorConfig{
+		ExcludeTypes:  defaultDiskUsageExcludeTypes,
+		ExcludeMounts: defaultDiskUsageExcludeMounts,
+	}
+	err := decodeOptions(body, &config)
 	if err != nil {
 		return err
 	}
 
-	for _, disk := range usage {
-		if disk.Type == "tmpfs" || disk.Type == "sysfs" || disk.Type == "proc" || (disk.Inodes == 0 && disk.Used == 0 && disk.Avail == 0) {
+	excludeTypes := map[string]struct{}{}
+	for _, fsType := range config.ExcludeTypes {
+		excludeTypes[fsType] = struct{}{}
+	}
+
+	excludeMounts := make([]*regexp.Regexp, 0, len(config.ExcludeMounts))
+	for _, pattern := range config.ExcludeMounts {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid mount pattern '%s': %v", pattern, err)
+		}
+		excludeMounts = append(excludeMounts, re)
+	}
+
+	d.excludeTypes = excludeTypes
+	d.excludeMounts = excludeMounts
+	return nil
+}
+
+func (d *diskUsageCollector) excluded(mount mountInfo) bool {
+	if _, ok := d.excludeTypes[mount.Type]; ok {
+		return true
+	}
+
+	for _, re := range d.excludeMounts {
+		if re.MatchString(mount.MountPath) {
+			return true
+		}
+	}
+	return false
+}
+
+func preferMount(a, b mountInfo) bool {
+	if (a.Root == "/") != (b.Root == "/") {
+		return a.Root == "/"
+	}
+	return len(a.MountPath) < len(b.MountPath)
+}
+
+func (d *diskUsageCollector) getDiskUsage(ctx context.Context) ([]DiskUsage, error) {
+	mounts, err := getMounts()
+	if err != nil {
+		return nil, err
+	}
+
+	// bind mounts share the device of the original mount, prefer the mount of
+	// the filesystem root and otherwise the shortest mount path
+	devices := map[string]mountInfo{}
+	order := []string{}
+	for _, mount := range mounts {
+		if d.excluded(mount) {
 			continue
 		}
 
-		if strings.Contains(disk.MountPath, "overlay2") {
+		existing, ok := devices[mount.Device]
+		if !ok {
+			order = append(order, mount.Device)
+		} else if !preferMount(mount, existing) {
 			continue
 		}
+		devices[mount.Device] = mount
+	}
 
+	var results []DiskUsage
+	for _, device := range order {
+		mount := devices[device]
+
+		stat, err := d.statfs(ctx, mount.MountPath)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			slog.Debug("disk_usage: failed to statfs", slog.String("mount", mount.MountPath), slog.Any("error", err))
+			continue
+		}
+
+		if stat.Blocks == 0 {
+			continue
+		}
+
+		// block counts are in units of the fragment size
+		bsize := uint64(stat.Frsize)
+		if bsize == 0 {
+			bsize = uint64(stat.Bsize)
+		}
+		results = append(results, DiskUsage{
+			FileSystemPath: mount.Source,
+			MountPath:      mount.MountPath,
+			Type:           mount.Type,
+			Device:         mount.Device,
+			ReadOnly:       stat.Flags&unix.ST_RDONLY != 0 || slices.Contains(mount.Options, "ro"),
+			Total:          stat.Blocks * bsize,
+			Free:           stat.Bfree * bsize,
+			Avail:          stat.Bavail * bsize,
+			Used:           (stat.Blocks - stat.Bfree) * bsize,
+			Reserved:       (stat.Bfree - stat.Bavail) * bsize,
+			Inodes:         stat.Files,
+			IFree:          stat.Ffree,
+			IUsed:          stat.Files - stat.Ffree,
+		})
+	}
+
+	return results, nil
+}
+
+func (d *diskUsageCollector) Collect(ctx context.Context, sink common.Sink) error {
+	usage, err := d.getDiskUsage(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, disk := range usage {
 		tags := tags(
 			"path", disk.FileSystemPath,
 			"mount", disk.MountPath,
 			"type", disk.Type,
 		)
-		sink.WriteMetric(common.NewGauge("disk.free", disk.Avail, tags))
-		sink.WriteMetric(common.NewGauge("disk.used", disk.Used, tags))
+
+		readOnly := 0
+		if disk.ReadOnly {
+			readOnly = 1
+		}
+
+		// disk.free and disk.used keep the meaning they had when read from df,
+		// the available and used space in 1K blocks
+		sink.WriteMetric(common.NewGauge("disk.free", disk.Avail/1024, tags))
+		sink.WriteMetric(common.NewGauge("disk.used", disk.Used/1024, tags))
+		sink.WriteMetric(common.NewGauge("disk.total_bytes", disk.Total, tags))
+		sink.WriteMetric(common.NewGauge("disk.free_bytes", disk.Free, tags))
+		sink.WriteMetric(common.NewGauge("disk.avail_bytes", disk.Avail, tags))
+		sink.WriteMetric(common.NewGauge("disk.used_bytes", disk.Used, tags))
+		sink.WriteMetric(common.NewGauge("disk.reserved_bytes", disk.Reserved, tags))
+		sink.WriteMetric(common.NewGauge("disk.inodes.total", disk.Inodes, tags))
+		sink.WriteMetric(common.NewGauge("disk.inodes.free", disk.IFree, tags))
+		sink.WriteMetric(common.NewGauge("disk.inodes.used", disk.IUsed, tags))
+		sink.WriteMetric(common.NewGauge("disk.readonly", readOnly, tags))
 	}
 
 	return nil
-})
+}
+
+func init() {
+	Registry.Add("disk_usage", Configured(func() Collector { return newDiskUsageCollector() }))
+}
@@ -0,0 +1,284 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/b1naryth1ef/yamon/common"
+	"github.com/hashicorp/hcl/v2"
+)
+
+type fileMetricValue struct {
+	Name  string
+	Value float64
+}
+
+type fileMetricsParser func(data []byte) []fileMetricValue
+
+func parseFileValue(value string) (float64, bool) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	return v, err == nil
+}
+
+// key value [unit], values in kB (e.g. /proc/meminfo) are converted to bytes
+// while any other unit is ignored
+func parseFileKeyValue(data []byte) []fileMetricValue {
+	var result []fileMetricValue
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		parts := strings.Fields(string(line))
+		if len(parts) != 2 && len(parts) != 3 {
+			continue
+		}
+
+		v, ok := parseFileValue(parts[1])
+		if !ok {
+			continue
+		}
+		if len(parts) == 3 && parts[2] == "kB" {
+			v *= 1024
+		}
+		result = append(result, fileMetricValue{Name: strings.TrimSuffix(parts[0], ":"), Value: v})
+	}
+	return result
+}
+
+// [section[:]] key=value key=value
+func parseFileKeyEquals(data []byte) []fileMetricValue {
+	var result []fileMetricValue
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		section := ""
+		for _, part := range strings.Fields(string(line)) {
+			key, value, ok := strings.Cut(part, "=")
+			if !ok {
+				section = strings.ToLower(strings.TrimSuffix(part, ":"))
+				continue
+			}
+
+			v, ok := parseFileValue(value)
+			if !ok {
+				continue
+			}
+
+			if section != "" {
+				key = section + "." + key
+			}
+			result = append(result, fileMetricValue{Name: key, Value: v})
+		}
+	}
+	return result
+}
+
+// /proc/spl/kstat style tables, only numeric types are kept
+func parseFileKstat(data []byte) []fileMetricValue {
+	var result []fileMetricValue
+	for _, stat := range newKstat(data) {
+		if v, ok := parseFileValue(stat.data); ok {
+			result = append(result, fileMetricValue{Name: stat.name, Value: v})
+		}
+	}
+	return result
+}
+
+func parseFileSingle(data []byte) []fileMetricValue {
+	if v, ok := parseFileValue(string(data)); ok {
+		return []fileMetricValue{{Value: v}}
+	}
+	return nil
+}
+
+// /proc/net/netstat style tables, a header line followed by a values line
+// sharing the same prefix
+func parseFileTable(data []byte) []fileMetricValue {
+	var result []fileMetricValue
+	var section string
+	var keys []string
+
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		prefix, rest, ok := strings.Cut(string(line), ":")
+		if !ok {
+			continue
+		}
+
+		if section != prefix {
+			section = prefix
+			keys = strings.Fields(rest)
+			continue
+		}
+
+		for idx, value := range strings.Fields(rest) {
+			if idx >= len(keys) {
+				break
+			}
+
+			if v, ok := parseFileValue(value); ok {
+				result = append(result, fileMetricValue{
+					Name:  strings.ToLower(section) + "." + keys[idx],
+					Value: v,
+				})
+			}
+		}
+		section = ""
+	}
+	return result
+}
+
+var fileMetricsParsers = map[string]fileMetricsParser{
+	"key_value":  parseFileKeyValue,
+	"key_equals": parseFileKeyEquals,
+	"kstat":      parseFileKstat,
+	"single":     parseFileSingle,
+	"table":      parseFileTable,
+}
+
+type fileMetricsRuleConfig struct {
+	Path   string `hcl:"path,label"`
+	Format string `hcl:"format"`
+	Prefix string `hcl:"prefix"`
+	Type   string `hcl:"type,optional"`
+
+	// named groups in path_regex are added as tags, a group called "name" is
+	// instead appended to the metric name
+	PathRegex string            `hcl:"path_regex,optional"`
+	Tags      map[string]string `hcl:"tags,optional"`
+}
+
+type fileMetricsCollectorConfig struct {
+	Files []fileMetricsRuleConfig `hcl:"file,block"`
+}
+
+type fileMetricsRule struct {
+	config    fileMetricsRuleConfig
+	parser    fileMetricsParser
+	metric    common.MetricType
+	pathRegex *regexp.Regexp
+}
+
+func newFileMetricsRule(config fileMetricsRuleConfig) (*fileMetricsRule, error) {
+	parser, ok := fileMetricsParsers[config.Format]
+	if !ok {
+		return nil, fmt.Errorf("invalid format '%s'", config.Format)
+	}
+
+	if _, err := filepath.Match(config.Path, ""); err != nil {
+		return nil, fmt.Errorf("invalid path pattern '%s': %v", config.Path, err)
+	}
+
+	rule := &fileMetricsRule{
+		config: config,
+		parser: parser,
+		metric: common.MetricTypeGauge,
+	}
+
+	switch config.Type {
+	case "", common.MetricTypeGauge:
+	case common.MetricTypeCounter:
+		rule.metric = common.MetricTypeCounter
+	default:
+		return nil, fmt.Errorf("invalid metric type '%s'", config.Type)
+	}
+
+	if config.PathRegex != "" {
+		re, err := regexp.Compile(config.PathRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path_regex '%s': %v", config.PathRegex, err)
+		}
+		rule.pathRegex = re
+	}
+
+	return rule, nil
+}
+
+func (r *fileMetricsRule) collect(path string, sink common.Sink) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	tags := map[string]string{}
+	for k, v := range r.config.Tags {
+		tags[k] = v
+	}
+
+	prefix := r.config.Prefix
+	if r.pathRegex != nil {
+		match := r.pathRegex.FindStringSubmatch(path)
+		if match == nil {
+			return nil
+		}
+
+		for idx, group := range r.pathRegex.SubexpNames() {
+			if group == "" {
+				continue
+			} else if group == "name" {
+				prefix = prefix + "." + match[idx]
+			} else {
+				tags[group] = match[idx]
+			}
+		}
+	}
+
+	for _, value := range r.parser(data) {
+		name := prefix
+		if value.Name != "" {
+			name = prefix + "." + value.Name
+		}
+		sink.WriteMetric(common.NewMetric(name, r.metric, value.Value, tags))
+	}
+
+	return nil
+}
+
+type fileMetricsCollector struct {
+	rules []*fileMetricsRule
+}
+
+func (f *fileMetricsCollector) Configure(body hcl.Body) error {
+	var config fileMetricsCollectorConfig
+	err := decodeOptions(body, &config)
+	if err != nil {
+		return err
+	}
+
+	rules := make([]*fileMetricsRule, 0, len(config.Files))
+	for _, ruleConfig := range config.Files {
+		rule, err := newFileMetricsRule(ruleConfig)
+		if err != nil {
+			return fmt.Errorf("file_metrics '%s': %v", ruleConfig.Path, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	f.rules = rules
+	return nil
+}
+
+func (f *fileMetricsCollector) Collect(ctx context.Context, sink common.Sink) error {
+	for _, rule := range f.rules {
+		paths, err := filepath.Glob(rule.config.Path)
+		if err != nil {
+			return err
+		}
+
+		for _, path := range paths {
+			// files under /proc and /sys come and go, so a single failure should
+			// not prevent the rest from being collected
+			err := rule.collect(path, sink)
+			if err != nil {
+				slog.Debug("file_metrics: failed to collect file", slog.String("path", path), slog.Any("error", err))
+			}
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	Registry.Add("file_metrics", Configured(func() Collector { return &fileMetricsCollector{} }))
+}
@@ -0,0 +1,117 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFileMetricsParsers(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		data   string
+		values []fileMetricValue
+	}{
+		{
+			"single", "single", "1500\n",
+			[]fileMetricValue{{Value: 1500}},
+		},
+		{
+			"single not a number", "single", "up\n",
+			nil,
+		},
+		{
+			"key_value", "key_value", "nr_free_pages 12345\nnr_zone_inactive_anon 67\nbroken\n",
+			[]fileMetricValue{{Name: "nr_free_pages", Value: 12345}, {Name: "nr_zone_inactive_anon", Value: 67}},
+		},
+		{
+			"key_value with units", "key_value", "MemTotal:       16303412 kB\nMemFree:         1203412 kB\nHugePages_Total:       0\nHugepagesize:       2048 kB\n",
+			[]fileMetricValue{
+				{Name: "MemTotal", Value: 16303412 * 1024},
+				{Name: "MemFree", Value: 1203412 * 1024},
+				{Name: "HugePages_Total", Value: 0},
+				{Name: "Hugepagesize", Value: 2048 * 1024},
+			},
+		},
+		{
+			"key_value with other units", "key_value", "latency 12 ms\nstate up\n",
+			[]fileMetricValue{{Name: "latency", Value: 12}},
+		},
+		{
+			"key_equals", "key_equals", "some avg10=0.12 avg60=0.05 total=1234\nfull avg10=0.00 avg60=0.00 total=56\n",
+			[]fileMetricValue{
+				{Name: "some.avg10", Value: 0.12}, {Name: "some.avg60", Value: 0.05}, {Name: "some.total", Value: 1234},
+				{Name: "full.avg10", Value: 0}, {Name: "full.avg60", Value: 0}, {Name: "full.total", Value: 56},
+			},
+		},
+		{
+			"kstat", "kstat", "6 1 0x01 3 144 1234 5678\nname                            type data\nhits                            4    1024\nmisses                          4    12\nstate                           7    ONLINE\n",
+			[]fileMetricValue{{Name: "hits", Value: 1024}, {Name: "misses", Value: 12}},
+		},
+		{
+			"table", "table", "TcpExt: SyncookiesSent SyncookiesRecv\nTcpExt: 3 4\nIpExt: InNoRoutes\nIpExt: 7\n",
+			[]fileMetricValue{{Name: "tcpext.SyncookiesSent", Value: 3}, {Name: "tcpext.SyncookiesRecv", Value: 4}, {Name: "ipext.InNoRoutes", Value: 7}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := fileMetricsParsers[test.format]([]byte(test.data))
+			if !slices.Equal(values, test.values) {
+				t.Fatalf("got %+v, want %+v", values, test.values)
+			}
+		})
+	}
+}
+
+func TestFileMetricsPathRegex(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "eth0", "rx_bytes")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("4096\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rule, err := newFileMetricsRule(fileMetricsRuleConfig{
+		Path:      filepath.Join(dir, "*", "*"),
+		Format:    "single",
+		Prefix:    "net.statistics",
+		Type:      "counter",
+		PathRegex: `/(?P<iface>[^/]+)/(?P<name>[^/]+)$`,
+		Tags:      map[string]string{"source": "sysfs"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &testSink{}
+	if err := rule.collect(path, sink); err != nil {
+		t.Fatal(err)
+	}
+
+	metric := expectMetric(t, sink, "net.statistics.rx_bytes", 4096)
+	if metric.Tags["iface"] != "eth0" || metric.Tags["source"] != "sysfs" {
+		t.Fatalf("got tags %v", metric.Tags)
+	}
+
+	// files not matching the regex are skipped
+	rule, err = newFileMetricsRule(fileMetricsRuleConfig{Path: path, Format: "single", Prefix: "net", PathRegex: "/tx_bytes$"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink = &testSink{}
+	if err := rule.collect(path, sink); err != nil || len(sink.metrics) != 0 {
+		t.Fatalf("got %d metrics (error %v) for a path not matching path_regex", len(sink.metrics), err)
+	}
+
+	if _, err := newFileMetricsRule(fileMetricsRuleConfig{Path: path, Format: "single", PathRegex: "("}); err == nil {
+		t.Fatal("expected an error for an invalid path_regex")
+	}
+	if _, err := newFileMetricsRule(fileMetricsRuleConfig{Path: path, Format: "yaml"}); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
@@ -3,11 +3,16 @@ package collector
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/b1naryth1ef/yamon/common"
 	"github.com/b1naryth1ef/yamon/util"
+	"github.com/hashicorp/hcl/v2"
 )
 
 type NetworkDeviceStats struct {
@@ -50,21 +55,114 @@ func getNetworkDevices() ([]NetworkDevice, error) {
 		device.Tx.Bytes = util.ParseNumber(parts[9])
 		device.Tx.Packets = util.ParseNumber(parts[10])
 		device.Tx.Errors = util.ParseNumber(parts[11])
-		device.Rx.Drop = util.ParseNumber(parts[12])
+		device.Tx.Drop = util.ParseNumber(parts[12])
 		result = append(result, device)
 	}
 
 	return result, nil
 }
 
-var networkCollector = Simple("net", func(ctx context.Context, sink common.Sink) error {
+type NetworkLinkState struct {
+	OperState      string
+	Speed          int64
+	Carrier        uint64
+	CarrierChanges uint64
+}
+
+func readSysfsString(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func getNetworkLinkState(name string) (NetworkLinkState, error) {
+	base := filepath.Join("/sys/class/net", name)
+	state := NetworkLinkState{Speed: -1}
+
+	operState, err := readSysfsString(filepath.Join(base, "operstate"))
+	if err != nil {
+		return state, err
+	}
+	state.OperState = operState
+
+	// these return EINVAL when the link is down or for virtual devices
+	if speed, err := readSysfsString(filepath.Join(base, "speed")); err == nil {
+		if v, err := strconv.ParseInt(speed, 10, 64); err == nil {
+			state.Speed = v
+		}
+	}
+	if carrier, err := readSysfsString(filepath.Join(base, "carrier")); err == nil {
+		state.Carrier = util.ParseNumber(carrier)
+	}
+	if changes, err := readSysfsString(filepath.Join(base, "carrier_changes")); err == nil {
+		state.CarrierChanges = util.ParseNumber(changes)
+	}
+
+	return state, nil
+}
+
+var defaultNetworkExclude = []string{"veth*", "br-*"}
+
+type networkCollectorConfig struct {
+	// glob patterns matched against the interface name, an empty include list
+	// matches all interfaces
+	Include []string `hcl:"include,optional"`
+	Exclude []string `hcl:"exclude,optional"`
+}
+
+type networkCollector struct {
+	config networkCollectorConfig
+}
+
+func newNetworkCollector() *networkCollector {
+	return &networkCollector{
+		config: networkCollectorConfig{Exclude: defaultNetworkExclude},
+	}
+}
+
+func (n *networkCollector) Configure(body hcl.Body) error {
+	config := networkCollectorConfig{Exclude: defaultNetworkExclude}
+	err := decodeOptions(body, &config)
+	if err != nil {
+		return err
+	}
+
+	for _, pattern := range append(config.Include, config.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid interface pattern '%s': %v", pattern, err)
+		}
+	}
+
+	n.config = config
+	return nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *networkCollector) included(name string) bool {
+	if len(n.config.Include) > 0 && !matchAny(n.config.Include, name) {
+		return false
+	}
+	return !matchAny(n.config.Exclude, name)
+}
+
+func (n *networkCollector) Collect(ctx context.Context, sink common.Sink) error {
 	devices, err := getNetworkDevices()
 	if err != nil {
 		return err
 	}
 
 	for _, device := range devices {
-		if strings.HasPrefix(device.Name, "veth") || strings.HasPrefix(device.Name, "br-") {
+		if !n.included(device.Name) {
 			continue
 		}
 
@@ -75,13 +173,54 @@ var networkCollector = Simple("net", func(ctx context.Context, sink common.Sink)
 		sink.WriteMetric(common.NewCounter(
 			"net.rx.packets", device.Rx.Packets, tags,
 		))
+		sink.WriteMetric(common.NewCounter(
+			"net.rx.errors", device.Rx.Errors, tags,
+		))
+		sink.WriteMetric(common.NewCounter(
+			"net.rx.drop", device.Rx.Drop, tags,
+		))
 		sink.WriteMetric(common.NewCounter(
 			"net.tx.bytes", device.Tx.Bytes, tags,
 		))
 		sink.WriteMetric(common.NewCounter(
 			"net.tx.packets", device.Tx.Packets, tags,
 		))
+		sink.WriteMetric(common.NewCounter(
+			"net.tx.errors", device.Tx.Errors, tags,
+		))
+		sink.WriteMetric(common.NewCounter(
+			"net.tx.drop", device.Tx.Drop, tags,
+		))
+
+		state, err := getNetworkLinkState(device.Name)
+		if err != nil {
+			slog.Debug("net: failed to read link state", slog.String("iface", device.Name), slog.Any("error", err))
+			continue
+		}
+
+		up := 0
+		if state.OperState == "up" {
+			up = 1
+		}
+		sink.WriteMetric(common.NewGauge(
+			"net.link.up", up, map[string]string{"iface": device.Name, "operstate": state.OperState},
+		))
+		sink.WriteMetric(common.NewGauge(
+			"net.link.carrier", state.Carrier, tags,
+		))
+		sink.WriteMetric(common.NewCounter(
+			"net.link.carrier_changes", state.CarrierChanges, tags,
+		))
+		if state.Speed >= 0 {
+			sink.WriteMetric(common.NewGauge(
+				"net.link.speed_mbps", state.Speed, tags,
+			))
+		}
 	}
 
 	return nil
-})
+}
+
+func init() {
+	Registry.Add("net", Configured(func() Collector { return newNetworkCollector() }))
+}
@@ -0,0 +1,116 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/b1naryth1ef/yamon/common"
+	"github.com/b1naryth1ef/yamon/util"
+	"github.com/hashicorp/hcl/v2"
+)
+
+type nginxCollectorConfig struct {
+	// the location serving stub_status, e.g. "http://localhost/nginx_status"
+	URL string `hcl:"url,optional"`
+}
+
+type nginxStatus struct {
+	Active   uint64
+	Accepts  uint64
+	Handled  uint64
+	Requests uint64
+	Reading  uint64
+	Writing  uint64
+	Waiting  uint64
+}
+
+// parseNginxStatus parses the output of the stub_status module:
+//
+//	Active connections: 291
+//	server accepts handled requests
+//	 16630948 16630948 31070465
+//	Reading: 6 Writing: 179 Waiting: 106
+func parseNginxStatus(data string) (*nginxStatus, error) {
+	lines := strings.Split(strings.TrimSpace(data), "\n")
+	if len(lines) != 4 {
+		return nil, fmt.Errorf("unexpected stub_status output")
+	}
+
+	active, ok := strings.CutPrefix(strings.TrimSpace(lines[0]), "Active connections:")
+	if !ok {
+		return nil, fmt.Errorf("unexpected stub_status output")
+	}
+
+	totals := strings.Fields(lines[2])
+	states := strings.Fields(lines[3])
+	if len(totals) != 3 || len(states) != 6 {
+		return nil, fmt.Errorf("unexpected stub_status output")
+	}
+
+	return &nginxStatus{
+		Active:   util.ParseNumber(strings.TrimSpace(active)),
+		Accepts:  util.ParseNumber(totals[0]),
+		Handled:  util.ParseNumber(totals[1]),
+		Requests: util.ParseNumber(totals[2]),
+		Reading:  util.ParseNumber(states[1]),
+		Writing:  util.ParseNumber(states[3]),
+		Waiting:  util.ParseNumber(states[5]),
+	}, nil
+}
+
+// nginxCollector reports connection and request counts from stub_status
+type nginxCollector struct {
+	config nginxCollectorConfig
+	http   http.Client
+}
+
+func (n *nginxCollector) Configure(body hcl.Body) error {
+	return decodeOptions(body, &n.config)
+}
+
+func (n *nginxCollector) Collect(ctx context.Context, sink common.Sink) error {
+	if n.config.URL == "" {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.config.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := n.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, 4096))
+	if err != nil {
+		return err
+	}
+
+	status, err := parseNginxStatus(string(data))
+	if err != nil {
+		return err
+	}
+
+	sink.WriteMetric(common.NewGauge("nginx.connections.active", status.Active, nil))
+	sink.WriteMetric(common.NewGauge("nginx.connections.reading", status.Reading, nil))
+	sink.WriteMetric(common.NewGauge("nginx.connections.writing", status.Writing, nil))
+	sink.WriteMetric(common.NewGauge("nginx.connections.waiting", status.Waiting, nil))
+	sink.WriteMetric(common.NewCounter("nginx.connections.accepted", status.Accepts, nil))
+	sink.WriteMetric(common.NewCounter("nginx.connections.handled", status.Handled, nil))
+	sink.WriteMetric(common.NewCounter("nginx.requests", status.Requests, nil))
+	return nil
+}
+
+func init() {
+	Registry.Add("nginx", Configured(func() Collector { return &nginxCollector{} }))
+}
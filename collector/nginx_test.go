@@ -0,0 +1,43 @@
+package collector
+
+import "testing"
+
+func TestParseNginxStatus(t *testing.T) {
+	status, err := parseNginxStatus(loadTestdata(t, "testdata/nginx_stub_status.txt").String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := nginxStatus{
+		Active:   291,
+		Accepts:  16630948,
+		Handled:  16630948,
+		Requests: 31070465,
+		Reading:  6,
+		Writing:  179,
+		Waiting:  106,
+	}
+	if *status != want {
+		t.Fatalf("got %+v, want %+v", *status, want)
+	}
+}
+
+func TestParseNginxStatusInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"html", "<html><body>404 Not Found</body></html>"},
+		{"missing active", "server accepts handled requests\n 1 1 1\nReading: 0 Writing: 1 Waiting: 0\n"},
+		{"truncated totals", "Active connections: 1\nserver accepts handled requests\n 1 1\nReading: 0 Writing: 1 Waiting: 0\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parseNginxStatus(test.data); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,475 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/b1naryth1ef/yamon/common"
+	"github.com/hashicorp/hcl/v2"
+)
+
+type packageUpdates struct {
+	Upgradable int
+	Security   int
+}
+
+type packageManager interface {
+	Name() string
+	Installed(ctx context.Context) (map[string]string, error)
+	Updates(ctx context.Context) (packageUpdates, error)
+}
+
+// runPackageCommand returns the stdout of a command, exit codes listed in ok
+// are not treated as errors (e.g. dnf check-update exits 100 when updates exist)
+func runPackageCommand(ctx context.Context, ok []int, name string, args ...string) (*bytes.Buffer, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	err := cmd.Run()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || !slices.Contains(ok, exitErr.ExitCode()) {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	return &stdout, nil
+}
+
+func commandExists(names ...string) bool {
+	for _, name := range names {
+		if _, err := exec.LookPath(name); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+type aptPackageManager struct{}
+
+func (aptPackageManager) Name() string { return "apt" }
+
+func (aptPackageManager) Installed(ctx context.Context) (map[string]string, error) {
+	stdout, err := runPackageCommand(ctx, nil, "dpkg-query", "-W", "-f", "${db:Status-Abbrev}\t${Package}:${Architecture}\t${Version}\n")
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]string{}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		parts := strings.Split(scanner.Text(), "\t")
+		if len(parts) != 3 || !strings.HasPrefix(parts[0], "ii") {
+			continue
+		}
+		result[parts[1]] = parts[2]
+	}
+	return result, nil
+}
+
+func (aptPackageManager) Updates(ctx context.Context) (packageUpdates, error) {
+	var result packageUpdates
+
+	stdout, err := runPackageCommand(ctx, nil, "apt", "list", "--upgradable")
+	if err != nil {
+		return result, err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		parts := strings.Split(scanner.Text(), " ")
+		nameRepo := strings.Split(parts[0], "/")
+		if len(nameRepo) < 2 {
+			continue
+		}
+
+		if strings.Contains(nameRepo[1], "-security") {
+			result.Security += 1
+		} else {
+			result.Upgradable += 1
+		}
+	}
+	return result, nil
+}
+
+type dnfPackageManager struct {
+	command string
+}
+
+func (d dnfPackageManager) Name() string { return d.command }
+
+func (dnfPackageManager) Installed(ctx context.Context) (map[string]string, error) {
+	stdout, err := runPackageCommand(ctx, nil, "rpm", "-qa", "--qf", "%{NAME}.%{ARCH}\t%{EPOCHNUM}:%{VERSION}-%{RELEASE}\n")
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]string{}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		name, version, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		result[name] = version
+	}
+	return result, nil
+}
+
+// parses `<name>.<arch> <version> <repo>` lines, skipping headers and the
+// obsoleting packages section
+func parseDnfPackageList(stdout *bytes.Buffer) map[string]struct{} {
+	result := map[string]struct{}{}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Obsoleting") {
+			break
+		}
+
+		parts := strings.Fields(line)
+		if len(parts) != 3 || !strings.Contains(parts[0], ".") {
+			continue
+		}
+		result[parts[0]] = struct{}{}
+	}
+	return result
+}
+
+func (d dnfPackageManager) Updates(ctx context.Context) (packageUpdates, error) {
+	var result packageUpdates
+
+	// -C only uses the local metadata cache, leaving refreshing it over the
+	// network to the package manager's own timer
+	stdout, err := runPackageCommand(ctx, []int{100}, d.command, "-C", "-q", "check-update")
+	if err != nil {
+		return result, err
+	}
+	upgradable := parseDnfPackageList(stdout)
+
+	// <advisory> <type> <name>-<version>.<arch>
+	stdout, err = runPackageCommand(ctx, nil, d.command, "-C", "-q", "updateinfo", "list", "--security")
+	if err != nil {
+		return result, err
+	}
+
+	security := map[string]struct{}{}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) != 3 {
+			continue
+		}
+
+		idx := strings.LastIndex(parts[2], ".")
+		if idx == -1 {
+			continue
+		}
+		name, _ := splitPackageVersion(parts[2][:idx])
+		name = name + parts[2][idx:]
+
+		if _, ok := upgradable[name]; ok {
+			security[name] = struct{}{}
+		}
+	}
+
+	result.Security = len(security)
+	result.Upgradable = len(upgradable) - result.Security
+	return result, nil
+}
+
+type apkPackageManager struct{}
+
+func (apkPackageManager) Name() string { return "apk" }
+
+// splits `<name>-<version>-<release>`, package names may contain hyphens
+func splitPackageVersion(pkg string) (string, string) {
+	idx := strings.LastIndex(pkg, "-")
+	if idx <= 0 {
+		return pkg, ""
+	}
+	idx = strings.LastIndex(pkg[:idx], "-")
+	if idx <= 0 {
+		return pkg, ""
+	}
+	return pkg[:idx], pkg[idx+1:]
+}
+
+func (apkPackageManager) Installed(ctx context.Context) (map[string]string, error) {
+	stdout, err := runPackageCommand(ctx, nil, "apk", "info", "-v")
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]string{}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		name, version := splitPackageVersion(strings.TrimSpace(scanner.Text()))
+		if version == "" {
+			continue
+		}
+		result[name] = version
+	}
+	return result, nil
+}
+
+func (apkPackageManager) Updates(ctx context.Context) (packageUpdates, error) {
+	var result packageUpdates
+
+	// apk has no notion of security updates
+	stdout, err := runPackageCommand(ctx, nil, "apk", "version", "-l", "<")
+	if err != nil {
+		return result, err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), " < ") {
+			result.Upgradable += 1
+		}
+	}
+	return result, nil
+}
+
+type pacmanPackageManager struct{}
+
+func (pacmanPackageManager) Name() string { return "pacman" }
+
+func (pacmanPackageManager) Installed(ctx context.Context) (map[string]string, error) {
+	stdout, err := runPackageCommand(ctx, nil, "pacman", "-Q")
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]string{}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) != 2 {
+			continue
+		}
+		result[parts[0]] = parts[1]
+	}
+	return result, nil
+}
+
+func (pacmanPackageManager) Updates(ctx context.Context) (packageUpdates, error) {
+	var result packageUpdates
+
+	// pacman has no notion of security updates and -Qu exits 1 when there are
+	// no updates available
+	stdout, err := runPackageCommand(ctx, []int{1}, "pacman", "-Qu")
+	if err != nil {
+		return result, err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) != "" {
+			result.Upgradable += 1
+		}
+	}
+	return result, nil
+}
+
+func detectPackageManager() packageManager {
+	switch {
+	case commandExists("apt", "dpkg-query"):
+		return aptPackageManager{}
+	case commandExists("dnf", "rpm"):
+		return dnfPackageManager{command: "dnf"}
+	case commandExists("yum", "rpm"):
+		return dnfPackageManager{command: "yum"}
+	case commandExists("apk"):
+		return apkPackageManager{}
+	case commandExists("pacman"):
+		return pacmanPackageManager{}
+	}
+	return nil
+}
+
+type packageVersion struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type packageVersionChange struct {
+	Name string `json:"name"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type packageInventoryChanges struct {
+	Manager string                 `json:"manager"`
+	Initial bool                   `json:"initial,omitempty"`
+	Added   []packageVersion       `json:"added,omitempty"`
+	Removed []packageVersion       `json:"removed,omitempty"`
+	Changed []packageVersionChange `json:"changed,omitempty"`
+}
+
+func diffPackageInventory(previous, current map[string]string) packageInventoryChanges {
+	var changes packageInventoryChanges
+	for name, version := range current {
+		old, ok := previous[name]
+		if !ok {
+			changes.Added = append(changes.Added, packageVersion{Name: name, Version: version})
+		} else if old != version {
+			changes.Changed = append(changes.Changed, packageVersionChange{Name: name, From: old, To: version})
+		}
+	}
+
+	for name, version := range previous {
+		if _, ok := current[name]; !ok {
+			changes.Removed = append(changes.Removed, packageVersion{Name: name, Version: version})
+		}
+	}
+
+	return changes
+}
+
+type packagesCollectorConfig struct {
+	// emit a packages.inventory event with installed package changes
+	Inventory bool `hcl:"inventory,optional"`
+	// persists the last seen inventory so changes are tracked across restarts
+	InventoryPath string `hcl:"inventory_path,optional"`
+}
+
+type packagesCollector struct {
+	config    packagesCollectorConfig
+	manager   packageManager
+	detected  bool
+	inventory map[string]string
+}
+
+func (p *packagesCollector) Configure(body hcl.Body) error {
+	var config packagesCollectorConfig
+	err := decodeOptions(body, &config)
+	if err != nil {
+		return err
+	}
+
+	p.config = config
+	p.inventory = nil
+	return nil
+}
+
+func (p *packagesCollector) DefaultInterval() time.Duration {
+	return time.Hour
+}
+
+func (p *packagesCollector) loadInventory() map[string]string {
+	if p.inventory != nil || p.config.InventoryPath == "" {
+		return p.inventory
+	}
+
+	data, err := os.ReadFile(p.config.InventoryPath)
+	if err != nil {
+		return nil
+	}
+
+	var inventory map[string]string
+	if json.Unmarshal(data, &inventory) != nil {
+		return nil
+	}
+	return inventory
+}
+
+func (p *packagesCollector) saveInventory(inventory map[string]string) error {
+	p.inventory = inventory
+	if p.config.InventoryPath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(inventory)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p.config.InventoryPath, data, 0644)
+}
+
+func (p *packagesCollector) Collect(ctx context.Context, sink common.Sink) error {
+	if !p.detected {
+		p.manager = detectPackageManager()
+		p.detected = true
+	}
+
+	if p.manager == nil {
+		return nil
+	}
+
+	installed, err := p.manager.Installed(ctx)
+	if err != nil {
+		return err
+	}
+
+	updates, err := p.manager.Updates(ctx)
+	if err != nil {
+		return err
+	}
+
+	manager := p.manager.Name()
+	sink.WriteMetric(common.NewGauge("packages", len(installed)-updates.Security-updates.Upgradable, map[string]string{
+		"manager":    manager,
+		"security":   "false",
+		"upgradable": "false",
+	}))
+	sink.WriteMetric(common.NewGauge("packages", updates.Upgradable, map[string]string{
+		"manager":    manager,
+		"security":   "false",
+		"upgradable": "true",
+	}))
+	sink.WriteMetric(common.NewGauge("packages", updates.Security, map[string]string{
+		"manager":    manager,
+		"security":   "true",
+		"upgradable": "true",
+	}))
+
+	// the apt collector this replaced reported apt.packages without a manager tag
+	if manager == "apt" {
+		sink.WriteMetric(common.NewGauge("apt.packages", len(installed)-updates.Security-updates.Upgradable, map[string]string{
+			"security":   "false",
+			"upgradable": "false",
+		}))
+		sink.WriteMetric(common.NewGauge("apt.packages", updates.Upgradable, map[string]string{
+			"security":   "false",
+			"upgradable": "true",
+		}))
+		sink.WriteMetric(common.NewGauge("apt.packages", updates.Security, map[string]string{
+			"security":   "true",
+			"upgradable": "true",
+		}))
+	}
+
+	if !p.config.Inventory {
+		return nil
+	}
+
+	previous := p.loadInventory()
+	changes := diffPackageInventory(previous, installed)
+	changes.Manager = manager
+	changes.Initial = previous == nil
+
+	if changes.Initial || len(changes.Added)+len(changes.Removed)+len(changes.Changed) > 0 {
+		sink.WriteEvent(common.NewEventJSON("packages.inventory", changes, map[string]string{
+			"manager": manager,
+		}))
+	}
+
+	return p.saveInventory(installed)
+}
+
+func init() {
+	Registry.Add("packages", Configured(func() Collector { return &packagesCollector{} }))
+	Registry.Alias("apt", "packages")
+}
@@ -0,0 +1,245 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/b1naryth1ef/yamon/common"
+	"github.com/hashicorp/hcl/v2"
+	_ "github.com/lib/pq"
+)
+
+type postgresCollectorConfig struct {
+	// e.g. "postgres://yamon@localhost/postgres?sslmode=disable", the user
+	// should be granted the pg_monitor role
+	DSN string `hcl:"dsn,optional"`
+	// the number of largest tables of the connected database to estimate
+	// bloat for
+	BloatTables int `hcl:"bloat_tables,optional"`
+}
+
+var postgresDatabaseCounters = []string{
+	"xact_commit", "xact_rollback", "blks_read", "blks_hit", "tup_returned",
+	"tup_fetched", "tup_inserted", "tup_updated", "tup_deleted", "conflicts",
+	"temp_files", "temp_bytes", "deadlocks",
+}
+
+const postgresDatabaseQuery = `
+SELECT datname, numbackends, pg_database_size(datid),
+	xact_commit, xact_rollback, blks_read, blks_hit, tup_returned,
+	tup_fetched, tup_inserted, tup_updated, tup_deleted, conflicts,
+	temp_files, temp_bytes, deadlocks
+FROM pg_stat_database
+WHERE datname IS NOT NULL AND datname NOT IN ('template0', 'template1')`
+
+const postgresActivityQuery = `
+SELECT coalesce(datname, ''), coalesce(state, 'unknown'), count(*),
+	coalesce(max(extract(epoch FROM now() - xact_start)), 0)
+FROM pg_stat_activity
+WHERE backend_type = 'client backend'
+GROUP BY 1, 2`
+
+const postgresStandbyQuery = `
+SELECT
+	CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE coalesce(extract(epoch FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END,
+	coalesce(pg_wal_lsn_diff(pg_last_wal_receive_lsn(), pg_last_wal_replay_lsn()), 0)`
+
+const postgresReplicasQuery = `
+SELECT application_name, coalesce(host(client_addr), ''), state,
+	coalesce(pg_wal_lsn_diff(pg_current_wal_lsn(), replay_lsn), 0),
+	coalesce(extract(epoch FROM replay_lag), 0)
+FROM pg_stat_replication`
+
+// bloat is estimated from the share of dead tuples, which is cheap to compute
+// and tracks the space autovacuum has yet to reclaim
+const postgresBloatQuery = `
+SELECT schemaname, relname, pg_table_size(relid), n_live_tup, n_dead_tup
+FROM pg_stat_user_tables
+ORDER BY pg_table_size(relid) DESC
+LIMIT $1`
+
+// postgresCollector reports database statistics, connection counts,
+// replication lag and table bloat estimates of a postgres server
+type postgresCollector struct {
+	config postgresCollectorConfig
+	db     *sql.DB
+}
+
+func (p *postgresCollector) Configure(body hcl.Body) error {
+	p.config.BloatTables = 20
+	err := decodeOptions(body, &p.config)
+	if err != nil {
+		return err
+	}
+
+	if p.config.DSN == "" {
+		return nil
+	}
+
+	p.db, err = sql.Open("postgres", p.config.DSN)
+	if err != nil {
+		return err
+	}
+	p.db.SetMaxOpenConns(1)
+	return nil
+}
+
+func (p *postgresCollector) collectDatabases(ctx context.Context, sink common.Sink) error {
+	rows, err := p.db.QueryContext(ctx, postgresDatabaseQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var database string
+		var backends, size int64
+		counters := make([]int64, len(postgresDatabaseCounters))
+
+		dest := []any{&database, &backends, &size}
+		for idx := range counters {
+			dest = append(dest, &counters[idx])
+		}
+		err := rows.Scan(dest...)
+		if err != nil {
+			return err
+		}
+
+		tags := tags("database", database)
+		sink.WriteMetric(common.NewGauge("postgres.database.backends", backends, tags))
+		sink.WriteMetric(common.NewGauge("postgres.database.size_bytes", size, tags))
+		for idx, name := range postgresDatabaseCounters {
+			sink.WriteMetric(common.NewCounter(fmt.Sprintf("postgres.database.%s", name), counters[idx], tags))
+		}
+	}
+	return rows.Err()
+}
+
+func (p *postgresCollector) collectActivity(ctx context.Context, sink common.Sink) error {
+	var maxConnections int64
+	err := p.db.QueryRowContext(ctx, "SELECT current_setting('max_connections')::int").Scan(&maxConnections)
+	if err != nil {
+		return err
+	}
+	sink.WriteMetric(common.NewGauge("postgres.activity.max_connections", maxConnections, nil))
+
+	rows, err := p.db.QueryContext(ctx, postgresActivityQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var database, state string
+		var count int64
+		var maxXactAge float64
+		err := rows.Scan(&database, &state, &count, &maxXactAge)
+		if err != nil {
+			return err
+		}
+
+		tags := tags("database", database, "state", state)
+		sink.WriteMetric(common.NewGauge("postgres.activity.connections", count, tags))
+		sink.WriteMetric(common.NewGauge("postgres.activity.max_xact_age_seconds", maxXactAge, tags))
+	}
+	return rows.Err()
+}
+
+func (p *postgresCollector) collectReplication(ctx context.Context, sink common.Sink) error {
+	var inRecovery bool
+	err := p.db.QueryRowContext(ctx, "SELECT pg_is_in_recovery()").Scan(&inRecovery)
+	if err != nil {
+		return err
+	}
+
+	recovery := 0
+	if inRecovery {
+		recovery = 1
+	}
+	sink.WriteMetric(common.NewGauge("postgres.replication.in_recovery", recovery, nil))
+
+	if inRecovery {
+		var lagSeconds, lagBytes float64
+		err := p.db.QueryRowContext(ctx, postgresStandbyQuery).Scan(&lagSeconds, &lagBytes)
+		if err != nil {
+			return err
+		}
+		sink.WriteMetric(common.NewGauge("postgres.replication.lag_seconds", lagSeconds, nil))
+		sink.WriteMetric(common.NewGauge("postgres.replication.lag_bytes", lagBytes, nil))
+		return nil
+	}
+
+	rows, err := p.db.QueryContext(ctx, postgresReplicasQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, addr, state string
+		var lagBytes, lagSeconds float64
+		err := rows.Scan(&name, &addr, &state, &lagBytes, &lagSeconds)
+		if err != nil {
+			return err
+		}
+
+		tags := tags("replica", name, "client_addr", addr, "state", state)
+		sink.WriteMetric(common.NewGauge("postgres.replication.replica_lag_bytes", lagBytes, tags))
+		sink.WriteMetric(common.NewGauge("postgres.replication.replica_lag_seconds", lagSeconds, tags))
+	}
+	return rows.Err()
+}
+
+func (p *postgresCollector) collectBloat(ctx context.Context, sink common.Sink) error {
+	if p.config.BloatTables <= 0 {
+		return nil
+	}
+
+	rows, err := p.db.QueryContext(ctx, postgresBloatQuery, p.config.BloatTables)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schema, table string
+		var size, live, dead int64
+		err := rows.Scan(&schema, &table, &size, &live, &dead)
+		if err != nil {
+			return err
+		}
+
+		ratio := 0.0
+		if live+dead > 0 {
+			ratio = float64(dead) / float64(live+dead)
+		}
+
+		tags := tags("schema", schema, "table", table)
+		sink.WriteMetric(common.NewGauge("postgres.table.size_bytes", size, tags))
+		sink.WriteMetric(common.NewGauge("postgres.table.dead_tuples", dead, tags))
+		sink.WriteMetric(common.NewGauge("postgres.table.bloat_ratio", ratio, tags))
+		sink.WriteMetric(common.NewGauge("postgres.table.bloat_bytes", ratio*float64(size), tags))
+	}
+	return rows.Err()
+}
+
+func (p *postgresCollector) Collect(ctx context.Context, sink common.Sink) error {
+	if p.db == nil {
+		return nil
+	}
+
+	return errors.Join(
+		p.collectDatabases(ctx, sink),
+		p.collectActivity(ctx, sink),
+		p.collectReplication(ctx, sink),
+		p.collectBloat(ctx, sink),
+	)
+}
+
+func init() {
+	Registry.Add("postgres", Configured(func() Collector { return &postgresCollector{} }))
+}
@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/b1naryth1ef/yamon/collector/cgroup"
+	"github.com/b1naryth1ef/yamon/common"
+	"github.com/b1naryth1ef/yamon/util"
+)
+
+var pressureCollector = Simple("pressure", func(ctx context.Context, sink common.Sink) error {
+	entries, err := os.ReadDir("/proc/pressure")
+	if err != nil {
+		// PSI: is not enabled
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		err := cgroup.CollectPressure(
+			fmt.Sprintf("pressure.%s", entry.Name()),
+			filepath.Join("/proc/pressure", entry.Name()),
+			nil,
+			sink,
+		)
+		// PSI: can be compiled in but disabled at boot (psi=0)
+		if err != nil && !errors.Is(err, syscall.EOPNOTSUPP) {
+			return err
+		}
+	}
+
+	return nil
+})
+
+// cpu<N> fields as of schedstat version 15, the last three are the only ones
+// that are not specific to the (deprecated) yield/wakeup accounting.
+var schedStatCPUKeys = map[int]string{
+	7: "running_ns",
+	8: "waiting_ns",
+	9: "timeslices",
+}
+
+var schedStatCollector = Simple("schedstat", func(ctx context.Context, sink common.Sink) error {
+	data, err := os.ReadFile("/proc/schedstat")
+	if err != nil {
+		// schedstat: kernel built without CONFIG_SCHEDSTATS
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		parts := util.FilterRepeatingSpaces(strings.Split(string(line), " "))
+		if len(parts) < 10 || !strings.HasPrefix(parts[0], "cpu") {
+			continue
+		}
+
+		tags := tags("cpu", parts[0][3:])
+		for idx, key := range schedStatCPUKeys {
+			sink.WriteMetric(common.NewCounter(fmt.Sprintf("sched.%s", key), util.ParseNumber(parts[idx]), tags))
+		}
+	}
+
+	return nil
+})
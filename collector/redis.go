@@ -0,0 +1,262 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/b1naryth1ef/yamon/common"
+	"github.com/hashicorp/hcl/v2"
+)
+
+type redisCollectorConfig struct {
+	// redis://[user:password@]host:port, rediss:// for TLS or unix:///path
+	URL string `hcl:"url,optional"`
+}
+
+// INFO fields which only ever increase
+var redisCounters = map[string]struct{}{
+	"keyspace_hits":                {},
+	"keyspace_misses":              {},
+	"expired_keys":                 {},
+	"evicted_keys":                 {},
+	"rejected_connections":         {},
+	"sync_full":                    {},
+	"sync_partial_ok":              {},
+	"sync_partial_err":             {},
+	"used_cpu_sys":                 {},
+	"used_cpu_user":                {},
+	"used_cpu_sys_children":        {},
+	"used_cpu_user_children":       {},
+	"io_threaded_reads_processed":  {},
+	"io_threaded_writes_processed": {},
+}
+
+// writeRESPCommand encodes a command as an array of bulk strings
+func writeRESPCommand(w io.Writer, args ...string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// readRESPReply reads a simple string, error or bulk string reply
+func readRESPReply(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return "", fmt.Errorf("redis: %s", line[1:])
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return "", fmt.Errorf("invalid bulk string length '%s'", line[1:])
+		}
+		data := make([]byte, size+2)
+		_, err = io.ReadFull(r, data)
+		if err != nil {
+			return "", err
+		}
+		return string(data[:size]), nil
+	}
+	return "", fmt.Errorf("unexpected reply '%s'", line)
+}
+
+// parseRedisFields parses the "key=value,..." values of the keyspace,
+// commandstats and replication sections
+func parseRedisFields(value string) map[string]string {
+	result := map[string]string{}
+	for _, field := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(field, "=")
+		if ok {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+func writeRedisFields(sink common.MetricSink, prefix string, mtype common.MetricType, fields map[string]string, tags map[string]string) {
+	for k, v := range fields {
+		value, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			continue
+		}
+		sink.WriteMetric(common.NewMetric(prefix+k, mtype, value, tags))
+	}
+}
+
+// writeRedisInfo converts the output of INFO into metrics, numeric fields are
+// named redis.<field> while nested fields are tagged by their parent
+func writeRedisInfo(info string, sink common.MetricSink) {
+	var section string
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			section = strings.ToLower(strings.TrimSpace(line[1:]))
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		switch {
+		case section == "keyspace":
+			writeRedisFields(sink, "redis.keyspace.", common.MetricTypeGauge, parseRedisFields(value), tags("db", key))
+			continue
+		case section == "commandstats":
+			fields := parseRedisFields(value)
+			tags := tags("command", strings.TrimPrefix(key, "cmdstat_"))
+			writeRedisFields(sink, "redis.commandstats.", common.MetricTypeGauge, map[string]string{
+				"usec_per_call": fields["usec_per_call"],
+			}, tags)
+			delete(fields, "usec_per_call")
+			writeRedisFields(sink, "redis.commandstats.", common.MetricTypeCounter, fields, tags)
+			continue
+		case section == "errorstats":
+			writeRedisFields(sink, "redis.errorstats.", common.MetricTypeCounter, parseRedisFields(value), tags("error", strings.TrimPrefix(key, "errorstat_")))
+			continue
+		case section == "replication" && strings.HasPrefix(key, "slave") && strings.Contains(value, "="):
+			fields := parseRedisFields(value)
+			writeRedisFields(sink, "redis.replication.replica_", common.MetricTypeGauge, map[string]string{
+				"offset": fields["offset"],
+				"lag":    fields["lag"],
+			}, tags("replica", net.JoinHostPort(fields["ip"], fields["port"]), "state", fields["state"]))
+			continue
+		}
+
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+
+		mtype := common.MetricTypeGauge
+		if _, ok := redisCounters[key]; ok || strings.HasPrefix(key, "total_") {
+			mtype = common.MetricTypeCounter
+		}
+		sink.WriteMetric(common.NewMetric("redis."+key, mtype, v, nil))
+	}
+}
+
+// redisCollector reports every INFO section of a redis server
+type redisCollector struct {
+	config redisCollectorConfig
+	url    *url.URL
+}
+
+func (r *redisCollector) Configure(body hcl.Body) error {
+	err := decodeOptions(body, &r.config)
+	if err != nil {
+		return err
+	}
+
+	if r.config.URL == "" {
+		return nil
+	}
+
+	r.url, err = url.Parse(r.config.URL)
+	if err != nil {
+		return err
+	}
+
+	switch r.url.Scheme {
+	case "redis", "rediss", "unix":
+	default:
+		return fmt.Errorf("unsupported url scheme '%s'", r.url.Scheme)
+	}
+	return nil
+}
+
+func (r *redisCollector) dial(ctx context.Context) (net.Conn, error) {
+	var dialer net.Dialer
+
+	if r.url.Scheme == "unix" {
+		return dialer.DialContext(ctx, "unix", r.url.Path)
+	}
+
+	address := r.url.Host
+	if r.url.Port() == "" {
+		address = net.JoinHostPort(r.url.Hostname(), "6379")
+	}
+
+	if r.url.Scheme == "rediss" {
+		tlsDialer := &tls.Dialer{
+			NetDialer: &dialer,
+			Config:    &tls.Config{ServerName: r.url.Hostname()},
+		}
+		return tlsDialer.DialContext(ctx, "tcp", address)
+	}
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+func (r *redisCollector) Collect(ctx context.Context, sink common.Sink) error {
+	if r.url == nil {
+		return nil
+	}
+
+	conn, err := r.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	reader := bufio.NewReader(conn)
+
+	if password, ok := r.url.User.Password(); ok {
+		args := []string{"AUTH", password}
+		if username := r.url.User.Username(); username != "" {
+			args = []string{"AUTH", username, password}
+		}
+
+		err = writeRESPCommand(conn, args...)
+		if err == nil {
+			_, err = readRESPReply(reader)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// "all" includes the commandstats and errorstats sections
+	err = writeRESPCommand(conn, "INFO", "all")
+	if err != nil {
+		return err
+	}
+
+	info, err := readRESPReply(reader)
+	if err != nil {
+		return err
+	}
+
+	writeRedisInfo(info, sink)
+	return nil
+}
+
+func init() {
+	Registry.Add("redis", Configured(func() Collector { return &redisCollector{} }))
+}
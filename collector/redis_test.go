@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/b1naryth1ef/yamon/common"
+)
+
+// findTagged returns the metric with the given name and tag value
+func findTagged(t *testing.T, sink *testSink, name, tag, value string) *common.Metric {
+	t.Helper()
+
+	for _, metric := range sink.find(name) {
+		if metric.Tags[tag] == value {
+			return metric
+		}
+	}
+	t.Fatalf("no %s metric with %s=%s", name, tag, value)
+	return nil
+}
+
+func TestWriteRedisInfo(t *testing.T) {
+	sink := &testSink{}
+	writeRedisInfo(loadTestdata(t, "testdata/redis_info.txt").String(), sink)
+
+	tests := []struct {
+		name  string
+		value float64
+		mtype common.MetricType
+	}{
+		{"redis.connected_clients", 42, common.MetricTypeGauge},
+		{"redis.used_memory", 2463208, common.MetricTypeGauge},
+		{"redis.mem_fragmentation_ratio", 3.86, common.MetricTypeGauge},
+		{"redis.total_commands_processed", 9823411, common.MetricTypeCounter},
+		{"redis.keyspace_hits", 812345, common.MetricTypeCounter},
+		{"redis.expired_keys", 2312, common.MetricTypeCounter},
+		{"redis.used_cpu_user", 1423.123456, common.MetricTypeCounter},
+		{"redis.master_repl_offset", 5823412, common.MetricTypeGauge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metric := expectMetric(t, sink, test.name, test.value)
+			if metric.Type != test.mtype {
+				t.Fatalf("got type %v, want %v", metric.Type, test.mtype)
+			}
+		})
+	}
+
+	// textual fields are skipped
+	for _, name := range []string{"redis.redis_version", "redis.role", "redis.used_memory_human", "redis.slave0"} {
+		if metrics := sink.find(name); len(metrics) != 0 {
+			t.Fatalf("got %d %s metrics for a textual field", len(metrics), name)
+		}
+	}
+
+	if keys := findTagged(t, sink, "redis.keyspace.keys", "db", "db3"); keys.Value != 12 {
+		t.Fatalf("got %v keys in db3, want 12", keys.Value)
+	}
+	if keys := findTagged(t, sink, "redis.keyspace.keys", "db", "db0"); keys.Value != 1523 {
+		t.Fatalf("got %v keys in db0, want 1523", keys.Value)
+	}
+
+	calls := findTagged(t, sink, "redis.commandstats.calls", "command", "set")
+	if calls.Value != 120000 || calls.Type != common.MetricTypeCounter {
+		t.Fatalf("got set calls %+v, want a counter of 120000", calls)
+	}
+	perCall := findTagged(t, sink, "redis.commandstats.usec_per_call", "command", "get")
+	if perCall.Value != 2 || perCall.Type != common.MetricTypeGauge {
+		t.Fatalf("got get usec_per_call %+v, want a gauge of 2", perCall)
+	}
+
+	if errors := findTagged(t, sink, "redis.errorstats.count", "error", "WRONGTYPE"); errors.Value != 1 {
+		t.Fatalf("got %v WRONGTYPE errors, want 1", errors.Value)
+	}
+
+	lag := findTagged(t, sink, "redis.replication.replica_lag", "replica", "10.0.0.12:6379")
+	if lag.Value != 1 || lag.Tags["state"] != "online" {
+		t.Fatalf("got replica lag %+v, want 1 while online", lag)
+	}
+}
@@ -0,0 +1,232 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/b1naryth1ef/yamon/common"
+)
+
+type smartctlScan struct {
+	Devices []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"devices"`
+}
+
+type smartctlAttribute struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+	Raw   struct {
+		Value int64 `json:"value"`
+	} `json:"raw"`
+}
+
+type smartctlDevice struct {
+	Device struct {
+		Name     string `json:"name"`
+		Protocol string `json:"protocol"`
+	} `json:"device"`
+	ModelName    string `json:"model_name"`
+	SerialNumber string `json:"serial_number"`
+	SmartStatus  *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature *struct {
+		Current int `json:"current"`
+	} `json:"temperature"`
+	PowerOnTime *struct {
+		Hours int64 `json:"hours"`
+	} `json:"power_on_time"`
+	ATASmartAttributes *struct {
+		Table []smartctlAttribute `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NVMeSmartHealth *struct {
+		CriticalWarning int   `json:"critical_warning"`
+		AvailableSpare  int   `json:"available_spare"`
+		PercentageUsed  int   `json:"percentage_used"`
+		MediaErrors     int64 `json:"media_errors"`
+		ErrorLogEntries int64 `json:"num_err_log_entries"`
+		UnsafeShutdowns int64 `json:"unsafe_shutdowns"`
+	} `json:"nvme_smart_health_information_log"`
+}
+
+// ATA attributes reported as raw counters
+var smartATARawAttributes = map[int]string{
+	5:   "reallocated_sectors",
+	196: "reallocation_events",
+	197: "pending_sectors",
+	198: "uncorrectable_sectors",
+	199: "crc_errors",
+}
+
+// ATA attributes which report remaining life as the normalized value, these
+// differ between vendors so they are matched by the name smartctl gives them
+// (231 is a temperature on some drives). only the first present is reported.
+var smartATAWearAttributes = []struct {
+	ID   int
+	Name string
+}{
+	{177, "Wear_Leveling_Count"},
+	{173, "Wear_Leveling_Count"},
+	{233, "Media_Wearout_Indicator"},
+	{231, "SSD_Life_Left"},
+	{169, "Remaining_Lifetime_Perc"},
+}
+
+type smartHealthTransition struct {
+	Device   string `json:"device"`
+	Model    string `json:"model"`
+	Serial   string `json:"serial"`
+	Passed   bool   `json:"passed"`
+	Previous bool   `json:"previous"`
+}
+
+// runSmartctl runs smartctl and returns stdout, smartctl uses its exit code as
+// a bitmask where only the lowest two bits indicate the command failed.
+func runSmartctl(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "smartctl", args...)
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	err := cmd.Run()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode()&0x3 != 0 {
+			return nil, err
+		}
+	}
+
+	return stdout.Bytes(), nil
+}
+
+type smartCollector struct {
+	health map[string]bool
+}
+
+func (s *smartCollector) Collect(ctx context.Context, sink common.Sink) error {
+	if _, err := exec.LookPath("smartctl"); err != nil {
+		return nil
+	}
+
+	data, err := runSmartctl(ctx, "--scan-open", "--json")
+	if err != nil {
+		return err
+	}
+
+	var scan smartctlScan
+	err = json.Unmarshal(data, &scan)
+	if err != nil {
+		return err
+	}
+
+	for _, device := range scan.Devices {
+		// don't spin up disks in standby, they are skipped until they wake up
+		data, err := runSmartctl(ctx, "--json", "--all", "--nocheck=standby,0", "--device", device.Type, device.Name)
+		if err != nil {
+			slog.Warn("smart: failed to query device", slog.String("device", device.Name), slog.Any("error", err))
+			continue
+		}
+
+		var info smartctlDevice
+		err = json.Unmarshal(data, &info)
+		if err != nil {
+			slog.Warn("smart: failed to parse device info", slog.String("device", device.Name), slog.Any("error", err))
+			continue
+		}
+
+		s.write(device.Name, &info, sink)
+	}
+
+	return nil
+}
+
+func (s *smartCollector) DefaultInterval() time.Duration {
+	return time.Minute * 30
+}
+
+func (s *smartCollector) write(device string, info *smartctlDevice, sink common.Sink) {
+	tags := tags(
+		"device", device,
+		"model", info.ModelName,
+		"serial", info.SerialNumber,
+		"protocol", info.Device.Protocol,
+	)
+
+	if info.Temperature != nil {
+		sink.WriteMetric(common.NewGauge("smart.temperature", info.Temperature.Current, tags))
+	}
+
+	if info.PowerOnTime != nil {
+		sink.WriteMetric(common.NewCounter("smart.power_on_hours", info.PowerOnTime.Hours, tags))
+	}
+
+	if info.ATASmartAttributes != nil {
+		attributes := map[int]smartctlAttribute{}
+		for _, attr := range info.ATASmartAttributes.Table {
+			attributes[attr.ID] = attr
+			if name, ok := smartATARawAttributes[attr.ID]; ok {
+				sink.WriteMetric(common.NewGauge(fmt.Sprintf("smart.%s", name), attr.Raw.Value, tags))
+			}
+		}
+
+		for _, wear := range smartATAWearAttributes {
+			attr, ok := attributes[wear.ID]
+			if !ok || attr.Name != wear.Name {
+				continue
+			}
+
+			wearTags := maps.Clone(tags)
+			wearTags["attribute"] = strconv.Itoa(attr.ID)
+			sink.WriteMetric(common.NewGauge("smart.wear_percent", 100-attr.Value, wearTags))
+			break
+		}
+	}
+
+	if health := info.NVMeSmartHealth; health != nil {
+		sink.WriteMetric(common.NewGauge("smart.wear_percent", health.PercentageUsed, tags))
+		sink.WriteMetric(common.NewGauge("smart.available_spare", health.AvailableSpare, tags))
+		sink.WriteMetric(common.NewGauge("smart.critical_warning", health.CriticalWarning, tags))
+		sink.WriteMetric(common.NewCounter("smart.media_errors", health.MediaErrors, tags))
+		sink.WriteMetric(common.NewCounter("smart.error_log_entries", health.ErrorLogEntries, tags))
+		sink.WriteMetric(common.NewCounter("smart.unsafe_shutdowns", health.UnsafeShutdowns, tags))
+	}
+
+	if info.SmartStatus == nil {
+		return
+	}
+
+	passed := info.SmartStatus.Passed
+	passedValue := 0
+	if passed {
+		passedValue = 1
+	}
+	sink.WriteMetric(common.NewGauge("smart.passed", passedValue, tags))
+
+	previous, ok := s.health[device]
+	s.health[device] = passed
+
+	if ok && previous != passed {
+		sink.WriteEvent(common.NewEventJSON("smart.health", smartHealthTransition{
+			Device:   device,
+			Model:    info.ModelName,
+			Serial:   info.SerialNumber,
+			Passed:   passed,
+			Previous: previous,
+		}, tags))
+	}
+}
+
+func init() {
+	Registry.Add("smart", Configured(func() Collector { return &smartCollector{health: map[string]bool{}} }))
+}
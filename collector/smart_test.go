@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/b1naryth1ef/yamon/common"
+)
+
+type testSink struct {
+	metrics []*common.Metric
+	logs    []*common.LogEntry
+	events  []*common.Event
+}
+
+func (t *testSink) WriteMetric(metric *common.Metric) { t.metrics = append(t.metrics, metric) }
+func (t *testSink) WriteLog(entry *common.LogEntry)   { t.logs = append(t.logs, entry) }
+func (t *testSink) WriteEvent(event *common.Event)    { t.events = append(t.events, event) }
+
+// find returns all metrics with the given name
+func (t *testSink) find(name string) []*common.Metric {
+	var result []*common.Metric
+	for _, metric := range t.metrics {
+		if metric.Name == name {
+			result = append(result, metric)
+		}
+	}
+	return result
+}
+
+func loadSmartDevice(t *testing.T, path string) *smartctlDevice {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var info smartctlDevice
+	err = json.Unmarshal(data, &info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &info
+}
+
+func expectMetric(t *testing.T, sink *testSink, name string, value float64) *common.Metric {
+	t.Helper()
+
+	metrics := sink.find(name)
+	if len(metrics) != 1 {
+		t.Fatalf("got %d %s metrics, want 1", len(metrics), name)
+	}
+	if metrics[0].Value != value {
+		t.Fatalf("got %s = %v, want %v", name, metrics[0].Value, value)
+	}
+	return metrics[0]
+}
+
+func TestSmartWriteATA(t *testing.T) {
+	collector := &smartCollector{health: map[string]bool{}}
+	sink := &testSink{}
+	collector.write("/dev/sda", loadSmartDevice(t, "testdata/smart_sata.json"), sink)
+
+	expectMetric(t, sink, "smart.temperature", 34)
+	expectMetric(t, sink, "smart.power_on_hours", 21504)
+	expectMetric(t, sink, "smart.reallocated_sectors", 3)
+	expectMetric(t, sink, "smart.crc_errors", 1)
+	expectMetric(t, sink, "smart.passed", 1)
+
+	// 231 is the temperature on this drive and 233 is ignored once 177 matched
+	wear := expectMetric(t, sink, "smart.wear_percent", 7)
+	if wear.Tags["attribute"] != "177" {
+		t.Fatalf("got wear attribute %q, want 177", wear.Tags["attribute"])
+	}
+	if temp := sink.find("smart.temperature")[0]; temp.Tags["attribute"] != "" {
+		t.Fatalf("attribute tag leaked into other metrics: %v", temp.Tags)
+	}
+	if temp := sink.find("smart.temperature")[0]; temp.Tags["model"] != "Samsung SSD 860 EVO 500GB" {
+		t.Fatalf("got tags %v", temp.Tags)
+	}
+}
+
+func TestSmartWriteNVMe(t *testing.T) {
+	collector := &smartCollector{health: map[string]bool{}}
+	sink := &testSink{}
+	collector.write("/dev/nvme0", loadSmartDevice(t, "testdata/smart_nvme.json"), sink)
+
+	expectMetric(t, sink, "smart.wear_percent", 2)
+	expectMetric(t, sink, "smart.available_spare", 100)
+	expectMetric(t, sink, "smart.critical_warning", 4)
+	expectMetric(t, sink, "smart.error_log_entries", 12)
+	expectMetric(t, sink, "smart.unsafe_shutdowns", 37)
+	expectMetric(t, sink, "smart.passed", 0)
+}
+
+func TestSmartHealthTransition(t *testing.T) {
+	collector := &smartCollector{health: map[string]bool{}}
+	info := loadSmartDevice(t, "testdata/smart_sata.json")
+
+	sink := &testSink{}
+	collector.write("/dev/sda", info, sink)
+	collector.write("/dev/sda", info, sink)
+	if len(sink.events) != 0 {
+		t.Fatalf("got %d events without a health change", len(sink.events))
+	}
+
+	info.SmartStatus.Passed = false
+	collector.write("/dev/sda", info, sink)
+	if len(sink.events) != 1 || sink.events[0].Type != "smart.health" {
+		t.Fatalf("got events %v, want a single smart.health event", sink.events)
+	}
+
+	var transition smartHealthTransition
+	err := json.Unmarshal([]byte(sink.events[0].Data), &transition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transition.Passed || !transition.Previous || transition.Serial != "S3Z1NB0K123456A" {
+		t.Fatalf("got transition %+v", transition)
+	}
+}
@@ -0,0 +1,96 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/b1naryth1ef/yamon/common"
+	"github.com/b1naryth1ef/yamon/util"
+)
+
+// values in /proc/net/snmp which represent current state instead of counters
+var snmpGaugeKeys = map[string]struct{}{
+	"ip.Forwarding":    {},
+	"ip.DefaultTTL":    {},
+	"tcp.RtoAlgorithm": {},
+	"tcp.RtoMin":       {},
+	"tcp.RtoMax":       {},
+	"tcp.MaxConn":      {},
+	"tcp.CurrEstab":    {},
+}
+
+var snmpCollector = Simple("snmp", func(ctx context.Context, sink common.Sink) error {
+	data, err := os.ReadFile("/proc/net/snmp")
+	if err != nil {
+		return err
+	}
+
+	// same layout as /proc/net/netstat, a header line followed by a value line
+	// for each protocol
+	var key string
+	var keys []string
+
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		lineParts := strings.SplitN(string(line), ": ", 2)
+		if len(lineParts) < 2 {
+			continue
+		}
+
+		if key == "" {
+			key = lineParts[0]
+			keys = strings.Split(lineParts[1], " ")
+			continue
+		}
+
+		if lineParts[0] != key {
+			return fmt.Errorf("invalid snmp parse (order issue?)")
+		}
+
+		proto := strings.ToLower(key)
+		for idx, value := range strings.Split(lineParts[1], " ") {
+			if idx >= len(keys) {
+				break
+			}
+
+			v, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return err
+			}
+
+			name := fmt.Sprintf("%s.%s", proto, keys[idx])
+			if _, ok := snmpGaugeKeys[name]; ok {
+				sink.WriteMetric(common.NewGauge(fmt.Sprintf("snmp.%s", name), v, nil))
+			} else {
+				sink.WriteMetric(common.NewCounter(fmt.Sprintf("snmp.%s", name), v, nil))
+			}
+		}
+
+		key = ""
+	}
+
+	data, err = os.ReadFile("/proc/net/snmp6")
+	if err != nil {
+		// IPv6: is disabled
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		parts := strings.Fields(string(line))
+		if len(parts) != 2 {
+			continue
+		}
+
+		sink.WriteMetric(common.NewCounter(fmt.Sprintf("snmp6.%s", parts[0]), util.ParseNumber(parts[1]), nil))
+	}
+
+	return nil
+})
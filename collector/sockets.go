@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/b1naryth1ef/yamon/common"
+)
+
+// see include/net/tcp_states.h
+var tcpStates = map[string]string{
+	"01": "established",
+	"02": "syn_sent",
+	"03": "syn_recv",
+	"04": "fin_wait1",
+	"05": "fin_wait2",
+	"06": "time_wait",
+	"07": "close",
+	"08": "close_wait",
+	"09": "last_ack",
+	"0A": "listen",
+	"0B": "closing",
+	"0C": "new_syn_recv",
+}
+
+func countSocketStates(path string) (map[string]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	for _, state := range tcpStates {
+		counts[state] = 0
+	}
+
+	for idx, line := range bytes.Split(data, []byte{'\n'}) {
+		if idx == 0 {
+			continue
+		}
+
+		parts := strings.Fields(string(line))
+		if len(parts) < 4 {
+			continue
+		}
+
+		state, ok := tcpStates[parts[3]]
+		if !ok {
+			state = "unknown"
+		}
+		counts[state] += 1
+	}
+
+	return counts, nil
+}
+
+var socketsCollector = Simple("sockets", func(ctx context.Context, sink common.Sink) error {
+	for _, proto := range []string{"tcp", "tcp6"} {
+		counts, err := countSocketStates("/proc/net/" + proto)
+		if err != nil {
+			// IPv6: is disabled
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+
+		for state, count := range counts {
+			sink.WriteMetric(common.NewGauge("sockets.tcp", count, tags("proto", proto, "state", state)))
+		}
+	}
+
+	return nil
+})
@@ -0,0 +1,380 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/b1naryth1ef/yamon/common"
+	"github.com/hashicorp/hcl/v2"
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+const (
+	starlarkLocalContext = "context"
+	starlarkLocalSink    = "sink"
+	starlarkLocalScript  = "script"
+
+	// responses and files larger than this are truncated
+	starlarkMaxReadBytes = 16 * 1024 * 1024
+)
+
+// http.get requests are also bound by the context of the collector run
+var starlarkHTTPClient = &http.Client{Timeout: time.Second * 30}
+
+type starlarkScriptConfig struct {
+	Path string `hcl:"path,label"`
+
+	// exposed to the script as the "config" dict
+	Vars map[string]string `hcl:"vars,optional"`
+	// globs of files the script may read, nothing can be read by default
+	AllowedPaths []string `hcl:"allowed_paths,optional"`
+	// limits the number of computation steps of a single run
+	MaxSteps uint64 `hcl:"max_steps,optional"`
+}
+
+type starlarkCollectorConfig struct {
+	Scripts []starlarkScriptConfig `hcl:"script,block"`
+}
+
+type starlarkScript struct {
+	config  starlarkScriptConfig
+	collect starlark.Callable
+}
+
+var starlarkFileOptions = &syntax.FileOptions{
+	Set:             true,
+	While:           true,
+	TopLevelControl: true,
+	GlobalReassign:  true,
+}
+
+func starlarkContext(thread *starlark.Thread) context.Context {
+	return thread.Local(starlarkLocalContext).(context.Context)
+}
+
+func starlarkSink(thread *starlark.Thread, fn *starlark.Builtin) (common.Sink, error) {
+	sink, ok := thread.Local(starlarkLocalSink).(common.Sink)
+	if !ok {
+		return nil, fmt.Errorf("%s: can only be called from collect", fn.Name())
+	}
+	return sink, nil
+}
+
+func starlarkTags(tags *starlark.Dict) (map[string]string, error) {
+	result := map[string]string{}
+	if tags == nil {
+		return result, nil
+	}
+
+	for _, item := range tags.Items() {
+		key, ok := starlark.AsString(item[0])
+		if !ok {
+			return nil, fmt.Errorf("tag keys must be strings, got %s", item[0].Type())
+		}
+
+		if value, ok := starlark.AsString(item[1]); ok {
+			result[key] = value
+		} else {
+			result[key] = item[1].String()
+		}
+	}
+	return result, nil
+}
+
+// http.get(url, headers={}) -> struct(status, body, headers)
+func starlarkHTTPGet(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var url string
+	var headers *starlark.Dict
+	err := starlark.UnpackArgs(fn.Name(), args, kwargs, "url", &url, "headers?", &headers)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(starlarkContext(thread), http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	requestHeaders, err := starlarkTags(headers)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range requestHeaders {
+		req.Header.Set(k, v)
+	}
+
+	res, err := starlarkHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, starlarkMaxReadBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	responseHeaders := starlark.NewDict(len(res.Header))
+	for k := range res.Header {
+		responseHeaders.SetKey(starlark.String(k), starlark.String(res.Header.Get(k)))
+	}
+
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"status":  starlark.MakeInt(res.StatusCode),
+		"body":    starlark.String(body),
+		"headers": responseHeaders,
+	}), nil
+}
+
+// file.read(path) -> string, only paths matching allowed_paths may be read
+func starlarkFileRead(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var path string
+	err := starlark.UnpackArgs(fn.Name(), args, kwargs, "path", &path)
+	if err != nil {
+		return nil, err
+	}
+
+	path = filepath.Clean(path)
+	script := thread.Local(starlarkLocalScript).(*starlarkScript)
+
+	allowed := false
+	for _, pattern := range script.config.AllowedPaths {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("%s: reading '%s' is not allowed", fn.Name(), path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, starlarkMaxReadBytes))
+	if err != nil {
+		return nil, err
+	}
+	return starlark.String(data), nil
+}
+
+// sink.write_metric(name, value, type="gauge", tags={})
+func starlarkWriteMetric(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var value starlark.Value
+	var metricType = common.MetricTypeGauge
+	var tags *starlark.Dict
+	err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &name, "value", &value, "type?", &metricType, "tags?", &tags)
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := starlark.AsFloat(value)
+	if !ok {
+		return nil, fmt.Errorf("%s: value must be a number, got %s", fn.Name(), value.Type())
+	}
+
+	if metricType != common.MetricTypeGauge && metricType != common.MetricTypeCounter {
+		return nil, fmt.Errorf("%s: invalid metric type '%s'", fn.Name(), metricType)
+	}
+
+	metricTags, err := starlarkTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	sink, err := starlarkSink(thread, fn)
+	if err != nil {
+		return nil, err
+	}
+	sink.WriteMetric(common.NewMetric(name, metricType, v, metricTags))
+	return starlark.None, nil
+}
+
+// sink.write_log(service, data, level="", tags={})
+func starlarkWriteLog(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var service, data, level string
+	var tags *starlark.Dict
+	err := starlark.UnpackArgs(fn.Name(), args, kwargs, "service", &service, "data", &data, "level?", &level, "tags?", &tags)
+	if err != nil {
+		return nil, err
+	}
+
+	logTags, err := starlarkTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := common.NewLogEntry(service, data, logTags)
+	entry.Level = level
+	sink, err := starlarkSink(thread, fn)
+	if err != nil {
+		return nil, err
+	}
+	sink.WriteLog(entry)
+	return starlark.None, nil
+}
+
+// sink.write_event(type, data, tags={})
+func starlarkWriteEvent(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var eventType, data string
+	var tags *starlark.Dict
+	err := starlark.UnpackArgs(fn.Name(), args, kwargs, "type", &eventType, "data", &data, "tags?", &tags)
+	if err != nil {
+		return nil, err
+	}
+
+	eventTags, err := starlarkTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	sink, err := starlarkSink(thread, fn)
+	if err != nil {
+		return nil, err
+	}
+	sink.WriteEvent(common.NewEvent(eventType, data, eventTags))
+	return starlark.None, nil
+}
+
+func starlarkPredeclared(config starlarkScriptConfig) starlark.StringDict {
+	vars := starlark.NewDict(len(config.Vars))
+	for k, v := range config.Vars {
+		vars.SetKey(starlark.String(k), starlark.String(v))
+	}
+	vars.Freeze()
+
+	return starlark.StringDict{
+		"config": vars,
+		"json":   starlarkjson.Module,
+		"http": &starlarkstruct.Module{Name: "http", Members: starlark.StringDict{
+			"get": starlark.NewBuiltin("http.get", starlarkHTTPGet),
+		}},
+		"file": &starlarkstruct.Module{Name: "file", Members: starlark.StringDict{
+			"read": starlark.NewBuiltin("file.read", starlarkFileRead),
+		}},
+		"sink": &starlarkstruct.Module{Name: "sink", Members: starlark.StringDict{
+			"write_metric": starlark.NewBuiltin("sink.write_metric", starlarkWriteMetric),
+			"write_log":    starlark.NewBuiltin("sink.write_log", starlarkWriteLog),
+			"write_event":  starlark.NewBuiltin("sink.write_event", starlarkWriteEvent),
+		}},
+	}
+}
+
+func newStarlarkThread(name string) *starlark.Thread {
+	return &starlark.Thread{
+		Name: name,
+		Print: func(thread *starlark.Thread, msg string) {
+			slog.Debug("starlark: print", slog.String("script", thread.Name), slog.String("message", msg))
+		},
+		// scripts can't load other modules
+		Load: nil,
+	}
+}
+
+func loadStarlarkScript(config starlarkScriptConfig) (*starlarkScript, error) {
+	script := &starlarkScript{config: config}
+
+	thread := newStarlarkThread(config.Path)
+	thread.SetLocal(starlarkLocalContext, context.Background())
+	thread.SetLocal(starlarkLocalScript, script)
+
+	globals, err := starlark.ExecFileOptions(starlarkFileOptions, thread, config.Path, nil, starlarkPredeclared(config))
+	if err != nil {
+		return nil, err
+	}
+
+	collect, ok := globals["collect"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("script does not define a collect function")
+	}
+	script.collect = collect
+
+	return script, nil
+}
+
+func (s *starlarkScript) run(ctx context.Context, sink common.Sink) error {
+	thread := newStarlarkThread(s.config.Path)
+	thread.SetLocal(starlarkLocalContext, ctx)
+	thread.SetLocal(starlarkLocalSink, sink)
+	thread.SetLocal(starlarkLocalScript, s)
+	if s.config.MaxSteps > 0 {
+		thread.SetMaxExecutionSteps(s.config.MaxSteps)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel(ctx.Err().Error())
+		case <-done:
+		}
+	}()
+
+	_, err := starlark.Call(thread, s.collect, nil, nil)
+	return err
+}
+
+// starlarkCollector runs starlark scripts in process, each script defines a
+// collect function which is called on every run of the collector.
+type starlarkCollector struct {
+	scripts []*starlarkScript
+}
+
+func (s *starlarkCollector) Configure(body hcl.Body) error {
+	var config starlarkCollectorConfig
+	err := decodeOptions(body, &config)
+	if err != nil {
+		return err
+	}
+
+	scripts := make([]*starlarkScript, 0, len(config.Scripts))
+	for _, scriptConfig := range config.Scripts {
+		script, err := loadStarlarkScript(scriptConfig)
+		if err != nil {
+			return fmt.Errorf("starlark '%s': %v", scriptConfig.Path, err)
+		}
+		scripts = append(scripts, script)
+	}
+
+	s.scripts = scripts
+	return nil
+}
+
+// Collect runs every script, a failing script doesn't prevent the others from
+// running and the errors of all scripts are returned
+func (s *starlarkCollector) Collect(ctx context.Context, sink common.Sink) error {
+	var errs []error
+	for _, script := range s.scripts {
+		start := time.Now()
+		err := script.run(ctx, sink)
+		if err != nil {
+			if evalErr, ok := err.(*starlark.EvalError); ok {
+				err = fmt.Errorf("%s", evalErr.Backtrace())
+			}
+			errs = append(errs, fmt.Errorf("starlark '%s': %w", script.config.Path, err))
+			continue
+		}
+		slog.Debug("starlark: ran script", slog.String("path", script.config.Path), slog.String("duration", time.Since(start).String()))
+	}
+
+	return errors.Join(errs...)
+}
+
+func init() {
+	Registry.Add("starlark", Configured(func() Collector { return &starlarkCollector{} }))
+}
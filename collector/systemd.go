@@ -0,0 +1,197 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/b1naryth1ef/yamon/common"
+	"github.com/coreos/go-systemd/v22/dbus"
+)
+
+type systemdUnitState struct {
+	ActiveState string `json:"active_state"`
+	SubState    string `json:"sub_state"`
+}
+
+type systemdUnitTransition struct {
+	Unit string           `json:"unit"`
+	From systemdUnitState `json:"from"`
+	To   systemdUnitState `json:"to"`
+}
+
+// the restart counts of all services are refreshed every this many runs, in
+// between only services which changed state are queried
+const systemdRestartsRefreshRuns = 12
+
+type systemdCollector struct {
+	conn     *dbus.Conn
+	states   map[string]systemdUnitState
+	restarts map[string]uint32
+	runs     int
+}
+
+func newSystemdCollector() *systemdCollector {
+	return &systemdCollector{
+		states:   map[string]systemdUnitState{},
+		restarts: map[string]uint32{},
+	}
+}
+
+func (s *systemdCollector) connect(ctx context.Context) error {
+	if s.conn != nil && s.conn.Connected() {
+		return nil
+	}
+
+	if s.conn != nil {
+		s.conn.Close()
+	}
+
+	conn, err := dbus.NewSystemConnectionContext(ctx)
+	if err != nil {
+		s.conn = nil
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+// serviceName resolves a unit to the name journald would use as the
+// SYSLOG_IDENTIFIER for its output so that events can be matched up with the
+// log entries emitted by the journal client. it is only needed for transitions
+// and not cached, as a daemon-reload may change the unit's configuration.
+func (s *systemdCollector) serviceName(ctx context.Context, unit string) string {
+	name := strings.TrimSuffix(unit, filepath.Ext(unit))
+	if strings.HasSuffix(unit, ".service") {
+		prop, err := s.conn.GetServicePropertyContext(ctx, unit, "SyslogIdentifier")
+		if err == nil {
+			if v, ok := prop.Value.Value().(string); ok && v != "" {
+				return v
+			}
+		}
+
+		prop, err = s.conn.GetServicePropertyContext(ctx, unit, "ExecStart")
+		if err == nil {
+			if execs, ok := prop.Value.Value().([][]any); ok && len(execs) > 0 && len(execs[0]) > 0 {
+				if path, ok := execs[0][0].(string); ok && path != "" {
+					name = filepath.Base(path)
+				}
+			}
+		}
+	}
+
+	return name
+}
+
+// restartCount returns the NRestarts of a service, which is only queried when
+// the state of the service changed or the counts are due to be refreshed
+func (s *systemdCollector) restartCount(ctx context.Context, unit string, changed bool) (uint32, bool) {
+	restarts, ok := s.restarts[unit]
+	if ok && !changed && s.runs%systemdRestartsRefreshRuns != 0 {
+		return restarts, true
+	}
+
+	prop, err := s.conn.GetServicePropertyContext(ctx, unit, "NRestarts")
+	if err != nil {
+		slog.Debug("systemd: failed to fetch NRestarts", slog.String("unit", unit), slog.Any("error", err))
+		return restarts, ok
+	}
+
+	restarts, ok = prop.Value.Value().(uint32)
+	if ok {
+		s.restarts[unit] = restarts
+	}
+	return restarts, ok
+}
+
+func (s *systemdCollector) Collect(ctx context.Context, sink common.Sink) error {
+	// systemd: is not the init system
+	if _, err := os.Stat("/run/systemd/system"); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	units, err := s.conn.ListUnitsContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.runs += 1
+
+	failed := 0
+	seen := map[string]struct{}{}
+	for _, unit := range units {
+		seen[unit.Name] = struct{}{}
+
+		state := systemdUnitState{ActiveState: unit.ActiveState, SubState: unit.SubState}
+		previous, ok := s.states[unit.Name]
+		s.states[unit.Name] = state
+		changed := !ok || previous != state
+
+		unitType := strings.TrimPrefix(filepath.Ext(unit.Name), ".")
+		tags := tags(
+			"unit", unit.Name,
+			"unit_type", unitType,
+			"active_state", unit.ActiveState,
+			"sub_state", unit.SubState,
+			"load_state", unit.LoadState,
+		)
+
+		active := 0
+		if unit.ActiveState == "active" {
+			active = 1
+		} else if unit.ActiveState == "failed" {
+			failed += 1
+		}
+		sink.WriteMetric(common.NewGauge("systemd.unit.active", active, tags))
+
+		if unitType == "service" {
+			if restarts, ok := s.restartCount(ctx, unit.Name, changed); ok {
+				sink.WriteMetric(common.NewGauge("systemd.unit.restarts", restarts, map[string]string{
+					"unit":      unit.Name,
+					"unit_type": unitType,
+				}))
+			}
+		}
+
+		if !ok || !changed {
+			continue
+		}
+
+		sink.WriteEvent(common.NewEventJSON("systemd.unit.transition", systemdUnitTransition{
+			Unit: unit.Name,
+			From: previous,
+			To:   state,
+		}, map[string]string{
+			"unit":    unit.Name,
+			"service": s.serviceName(ctx, unit.Name),
+		}))
+	}
+
+	for name := range s.states {
+		if _, ok := seen[name]; !ok {
+			delete(s.states, name)
+			delete(s.restarts, name)
+		}
+	}
+
+	sink.WriteMetric(common.NewGauge("systemd.units.failed", failed, nil))
+	sink.WriteMetric(common.NewGauge("systemd.units.total", len(units), nil))
+
+	return nil
+}
+
+func init() {
+	Registry.Add("systemd", Configured(func() Collector { return newSystemdCollector() }))
+}
@@ -97,7 +97,9 @@ var zfsCollector = Simple("zfs", func(ctx context.Context, sink common.Sink) err
 				return err
 			}
 
-			var keys = map[string]string{}
+			var keys = map[string]string{
+				"pool": entry.Name(),
+			}
 
 			for _, stat := range newKstat(data) {
 				if stat.name == "dataset_name" {
@@ -0,0 +1,262 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/b1naryth1ef/yamon/common"
+	"github.com/b1naryth1ef/yamon/util"
+)
+
+type zpoolPool struct {
+	Name     string
+	Size     uint64
+	Alloc    uint64
+	Free     uint64
+	Capacity uint64
+	Health   string
+	// fragmentation is reported as "-" for pools without spacemap histograms
+	Fragmentation    uint64
+	HasFragmentation bool
+}
+
+type zpoolVdev struct {
+	Name     string
+	State    string
+	Read     uint64
+	Write    uint64
+	Checksum uint64
+}
+
+type zpoolStatus struct {
+	Name     string
+	State    string
+	Scan     string
+	Scanning bool
+	Progress float64
+	Vdevs    []zpoolVdev
+}
+
+type zpoolHealthTransition struct {
+	Pool     string `json:"pool"`
+	Health   string `json:"health"`
+	Previous string `json:"previous"`
+}
+
+var zpoolProgressRe = regexp.MustCompile(`([0-9.]+)% done`)
+
+func runZpool(ctx context.Context, args ...string) (*bytes.Buffer, error) {
+	cmd := exec.CommandContext(ctx, "zpool", args...)
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, err
+	}
+	return &stdout, nil
+}
+
+// parses the output of `zpool list -H -p -o name,size,alloc,free,frag,cap,health`
+func parseZpoolList(data *bytes.Buffer) []*zpoolPool {
+	var result []*zpoolPool
+
+	scanner := bufio.NewScanner(data)
+	for scanner.Scan() {
+		parts := strings.Split(scanner.Text(), "\t")
+		if len(parts) != 7 {
+			continue
+		}
+
+		result = append(result, &zpoolPool{
+			Name:             parts[0],
+			Size:             util.ParseNumber(parts[1]),
+			Alloc:            util.ParseNumber(parts[2]),
+			Free:             util.ParseNumber(parts[3]),
+			Fragmentation:    util.ParseNumber(parts[4]),
+			HasFragmentation: parts[4] != "-",
+			Capacity:         util.ParseNumber(parts[5]),
+			Health:           parts[6],
+		})
+	}
+
+	return result
+}
+
+// parses the human readable output of `zpool status -p`, continuation lines of
+// the scan and config sections are indented with tabs
+func parseZpoolStatus(data *bytes.Buffer) []*zpoolStatus {
+	var result []*zpoolStatus
+	var current *zpoolStatus
+	var inScan, inConfig bool
+
+	scanner := bufio.NewScanner(data)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		key, value, ok := strings.Cut(trimmed, ": ")
+		if !ok && strings.HasSuffix(trimmed, ":") {
+			key, ok = strings.TrimSuffix(trimmed, ":"), true
+		}
+
+		if ok && !strings.Contains(key, " ") && !strings.HasPrefix(line, "\t") {
+			inScan, inConfig = false, false
+			switch key {
+			case "pool":
+				current = &zpoolStatus{Name: value}
+				result = append(result, current)
+			case "state":
+				if current != nil {
+					current.State = value
+				}
+			case "scan":
+				if current != nil {
+					inScan = true
+					// pools which were never scrubbed report "none requested"
+					if strings.HasPrefix(value, "resilver") {
+						current.Scan = "resilver"
+					} else if strings.HasPrefix(value, "scrub") {
+						current.Scan = "scrub"
+					}
+					current.Scanning = current.Scan != "" && strings.Contains(value, "in progress")
+				}
+			case "config":
+				inConfig = true
+			}
+			continue
+		}
+
+		if current == nil {
+			continue
+		}
+
+		if inScan {
+			if match := zpoolProgressRe.FindStringSubmatch(trimmed); match != nil {
+				current.Progress = util.ParseFloat(match[1])
+			}
+			continue
+		}
+
+		if inConfig {
+			parts := strings.Fields(trimmed)
+			if len(parts) < 5 || parts[0] == "NAME" {
+				continue
+			}
+
+			current.Vdevs = append(current.Vdevs, zpoolVdev{
+				Name:     parts[0],
+				State:    parts[1],
+				Read:     util.ParseNumber(parts[2]),
+				Write:    util.ParseNumber(parts[3]),
+				Checksum: util.ParseNumber(parts[4]),
+			})
+		}
+	}
+
+	return result
+}
+
+type zpoolCollector struct {
+	health map[string]string
+}
+
+func (z *zpoolCollector) Collect(ctx context.Context, sink common.Sink) error {
+	if _, err := exec.LookPath("zpool"); err != nil {
+		return nil
+	}
+
+	// name, size, alloc, free, frag, cap, health
+	list, err := runZpool(ctx, "list", "-H", "-p", "-o", "name,size,alloc,free,frag,cap,health")
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]struct{}{}
+	for _, info := range parseZpoolList(list) {
+		pool := info.Name
+		health := info.Health
+		seen[pool] = struct{}{}
+
+		// prefer the kstat state which is updated without taking the pool lock
+		if state, err := os.ReadFile(filepath.Join("/proc/spl/kstat/zfs", pool, "state")); err == nil {
+			health = strings.TrimSpace(string(state))
+		}
+
+		tags := tags("pool", pool)
+		sink.WriteMetric(common.NewGauge("zfs.pool.size", info.Size, tags))
+		sink.WriteMetric(common.NewGauge("zfs.pool.alloc", info.Alloc, tags))
+		sink.WriteMetric(common.NewGauge("zfs.pool.free", info.Free, tags))
+		sink.WriteMetric(common.NewGauge("zfs.pool.capacity", info.Capacity, tags))
+		if info.HasFragmentation {
+			sink.WriteMetric(common.NewGauge("zfs.pool.fragmentation", info.Fragmentation, tags))
+		}
+
+		online := 0
+		if health == "ONLINE" {
+			online = 1
+		}
+		sink.WriteMetric(common.NewGauge("zfs.pool.online", online, map[string]string{
+			"pool":   pool,
+			"health": health,
+		}))
+
+		previous, ok := z.health[pool]
+		z.health[pool] = health
+		if ok && previous != health {
+			sink.WriteEvent(common.NewEventJSON("zfs.pool.health", zpoolHealthTransition{
+				Pool:     pool,
+				Health:   health,
+				Previous: previous,
+			}, map[string]string{"pool": pool}))
+		}
+	}
+
+	for pool := range z.health {
+		if _, ok := seen[pool]; !ok {
+			delete(z.health, pool)
+		}
+	}
+
+	status, err := runZpool(ctx, "status", "-p")
+	if err != nil {
+		return err
+	}
+
+	for _, pool := range parseZpoolStatus(status) {
+		if pool.Scan != "" {
+			tags := tags("pool", pool.Name, "scan", pool.Scan)
+			scanning := 0
+			if pool.Scanning {
+				scanning = 1
+				sink.WriteMetric(common.NewGauge("zfs.pool.scan.progress", pool.Progress, tags))
+			}
+			sink.WriteMetric(common.NewGauge("zfs.pool.scan.active", scanning, tags))
+		}
+
+		for _, vdev := range pool.Vdevs {
+			tags := tags("pool", pool.Name, "vdev", vdev.Name, "state", vdev.State)
+			for name, value := range map[string]uint64{
+				"read":     vdev.Read,
+				"write":    vdev.Write,
+				"checksum": vdev.Checksum,
+			} {
+				sink.WriteMetric(common.NewCounter(fmt.Sprintf("zfs.vdev.errors.%s", name), value, tags))
+			}
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	Registry.Add("zpool", Configured(func() Collector { return &zpoolCollector{health: map[string]string{}} }))
+}
@@ -0,0 +1,85 @@
+package collector
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func loadTestdata(t *testing.T, path string) *bytes.Buffer {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewBuffer(data)
+}
+
+func TestParseZpoolList(t *testing.T) {
+	pools := parseZpoolList(loadTestdata(t, "testdata/zpool_list.txt"))
+
+	tests := []zpoolPool{
+		{Name: "backup", Size: 11991548755968, Alloc: 4398046511104, Free: 7593502244864, Capacity: 36, Health: "DEGRADED"},
+		{Name: "rpool", Size: 493921239040, Alloc: 98784247808, Free: 395136991232, Capacity: 20, Health: "ONLINE", Fragmentation: 8, HasFragmentation: true},
+		{Name: "tank", Size: 3985729650688, Alloc: 2748779069440, Free: 1236950581248, Capacity: 68, Health: "ONLINE", Fragmentation: 12, HasFragmentation: true},
+		{Name: "vault", Size: 1992864825344, Alloc: 1099511627776, Free: 893353197568, Capacity: 55, Health: "ONLINE", Fragmentation: 3, HasFragmentation: true},
+	}
+
+	if len(pools) != len(tests) {
+		t.Fatalf("got %d pools, want %d", len(pools), len(tests))
+	}
+	for idx, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			if *pools[idx] != test {
+				t.Fatalf("got %+v, want %+v", *pools[idx], test)
+			}
+		})
+	}
+}
+
+func TestParseZpoolStatus(t *testing.T) {
+	pools := parseZpoolStatus(loadTestdata(t, "testdata/zpool_status.txt"))
+
+	tests := []struct {
+		name     string
+		state    string
+		scan     string
+		scanning bool
+		progress float64
+		vdevs    int
+	}{
+		// never scrubbed, no scan metrics are reported
+		{"backup", "DEGRADED", "", false, 0, 5},
+		{"rpool", "ONLINE", "scrub", false, 0, 2},
+		{"tank", "ONLINE", "scrub", true, 23.91, 5},
+		{"vault", "ONLINE", "resilver", true, 6.51, 4},
+	}
+
+	if len(pools) != len(tests) {
+		t.Fatalf("got %d pools, want %d", len(pools), len(tests))
+	}
+	for idx, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pool := pools[idx]
+			if pool.Name != test.name || pool.State != test.state {
+				t.Fatalf("got pool %s in state %s, want %s in state %s", pool.Name, pool.State, test.name, test.state)
+			}
+			if pool.Scan != test.scan || pool.Scanning != test.scanning || pool.Progress != test.progress {
+				t.Fatalf("got scan %q (active %v, %v%%), want %q (active %v, %v%%)", pool.Scan, pool.Scanning, pool.Progress, test.scan, test.scanning, test.progress)
+			}
+			if len(pool.Vdevs) != test.vdevs {
+				t.Fatalf("got %d vdevs, want %d: %+v", len(pool.Vdevs), test.vdevs, pool.Vdevs)
+			}
+		})
+	}
+
+	// the unavailable device is listed by its guid, trailing notes are ignored
+	missing := pools[0].Vdevs[4]
+	if missing.Name != "11930294567396839041" || missing.State != "UNAVAIL" {
+		t.Fatalf("got %+v for the missing device", missing)
+	}
+	if checksum := pools[2].Vdevs[3]; checksum.Checksum != 2 {
+		t.Fatalf("got %+v, want 2 checksum errors", checksum)
+	}
+}
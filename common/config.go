@@ -1,8 +1,16 @@
 package common
 
 import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
 	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
 	"github.com/hashicorp/hcl/v2/hclsimple"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/function"
 )
@@ -22,20 +30,44 @@ type ServerClickhouseConfig struct {
 }
 
 type DaemonConfig struct {
-	Target     string                    `hcl:"target"`
-	Collectors []CollectorConfig         `hcl:"collector,block"`
+	Target string `hcl:"target"`
+	// decoded by decodeCollectorBlocks as the instance label is optional
+	Collectors []CollectorConfig
 	Prometheus []PrometheusScraperConfig `hcl:"prometheus,block"`
 	LogFile    []LogFileBlock            `hcl:"log_file,block"`
 	Scripts    []DaemonScriptConfig      `hcl:"script,block"`
 	Journal    *DaemonJournalConfig      `hcl:"journal,block"`
 	HTTP       *DaemonHTTPConfig         `hcl:"http,block"`
+	LogMetrics []LogMetricConfig         `hcl:"log_metric,block"`
+	Syslog     []DaemonSyslogConfig      `hcl:"syslog,block"`
+	Statsd     []DaemonStatsdConfig      `hcl:"statsd,block"`
+	Probes     []ProbeConfig             `hcl:"probe,block"`
+
+	// where the read position of log_file inputs is stored, without it files
+	// are always followed from their end when yamon starts
+	LogFilePositionPath string `hcl:"log_file_position_path,optional"`
+
+	// how often metrics derived from log_metric rules are emitted
+	LogMetricInterval string `hcl:"log_metric_interval,optional"`
 }
 
 type CollectorConfig struct {
-	Name     string `hcl:"name,label"`
+	Name string
+	// optional second label allowing multiple instances of a collector, e.g.
+	// collector "net" "uplinks" { ... }. json configs have a single label of
+	// the form "net/uplinks" instead
+	Instance string
+
 	Disabled bool   `hcl:"disabled,optional"`
 	Interval string `hcl:"interval,optional"`
 	Timeout  string `hcl:"timeout,optional"`
+	// runs are aligned to the interval, offset by up to this much
+	Splay string `hcl:"splay,optional"`
+	// static tags added to everything the collector emits
+	Tags map[string]string `hcl:"tags,optional"`
+
+	// collector specific options, see collector.Configurable
+	Options hcl.Body `hcl:",remain"`
 }
 
 type DaemonScriptConfig struct {
@@ -44,31 +76,163 @@ type DaemonScriptConfig struct {
 	Env       map[string]string `hcl:"env,optional"`
 	Interval  string            `hcl:"interval,optional"`
 	Timeout   string            `hcl:"timeout,optional"`
+	Splay     string            `hcl:"splay,optional"`
 	Streaming bool              `hcl:"streaming,optional"`
+	// json (default), ndjson, prometheus, influx or nagios
+	Format string `hcl:"format,optional"`
+
+	User  string `hcl:"user,optional"`
+	Group string `hcl:"group,optional"`
+	Dir   string `hcl:"dir,optional"`
+	// do not inherit the environment of the agent
+	CleanEnv bool `hcl:"clean_env,optional"`
+	// e.g. "256M", enforced with a cgroup or rlimits when cgroups are unavailable
+	MemoryLimit string `hcl:"memory_limit,optional"`
+	// in cpus, requires cgroups (v2)
+	CPULimit float64 `hcl:"cpu_limit,optional"`
+	// maximum bytes of stdout (per line for streaming scripts)
+	MaxOutput string `hcl:"max_output,optional"`
 }
 
 type DaemonHTTPConfig struct {
 	Bind string `hcl:"bind"`
 }
 
+type DaemonSyslogConfig struct {
+	UDP string                 `hcl:"udp,optional"`
+	TCP string                 `hcl:"tcp,optional"`
+	TLS *DaemonSyslogTLSConfig `hcl:"tls,block"`
+
+	// used for messages which do not include an app name
+	Service string            `hcl:"service,optional"`
+	Tags    map[string]string `hcl:"tags,optional"`
+}
+
+type DaemonSyslogTLSConfig struct {
+	Bind     string `hcl:"bind"`
+	CertFile string `hcl:"cert_file"`
+	KeyFile  string `hcl:"key_file"`
+	// when set clients must present a certificate signed by this CA
+	ClientCAFile string `hcl:"client_ca_file,optional"`
+}
+
+type DaemonStatsdConfig struct {
+	UDP      string `hcl:"udp,optional"`
+	Unixgram string `hcl:"unixgram,optional"`
+
+	FlushInterval string `hcl:"flush_interval,optional"`
+	// timer percentiles, defaults to 50, 90, 95 and 99
+	Percentiles []float64         `hcl:"percentiles,optional"`
+	Prefix      string            `hcl:"prefix,optional"`
+	Tags        map[string]string `hcl:"tags,optional"`
+}
+
+type ProbeConfig struct {
+	// one of http, tcp, dns or icmp
+	Type string `hcl:"type,label"`
+	Name string `hcl:"name,label"`
+
+	// a url for http, host:port for tcp and a hostname for dns and icmp
+	Target   string            `hcl:"target"`
+	Interval string            `hcl:"interval,optional"`
+	Timeout  string            `hcl:"timeout,optional"`
+	Splay    string            `hcl:"splay,optional"`
+	Tags     map[string]string `hcl:"tags,optional"`
+
+	Method  string            `hcl:"method,optional"`
+	Headers map[string]string `hcl:"headers,optional"`
+	// defaults to any 2xx status
+	ExpectStatus       []int  `hcl:"expect_status,optional"`
+	BodyRegex          string `hcl:"body_regex,optional"`
+	InsecureSkipVerify bool   `hcl:"insecure_skip_verify,optional"`
+
+	// host[:port] of the dns server, defaults to the system resolver
+	Server string `hcl:"server,optional"`
+	// A (default), AAAA, CNAME, MX, NS or TXT
+	RecordType string `hcl:"record_type,optional"`
+	// answers which must all be present
+	Expect []string `hcl:"expect,optional"`
+
+	// number of echo requests sent by each icmp probe
+	Count int `hcl:"count,optional"`
+}
+
 type DaemonJournalConfig struct {
 	Enabled         bool     `hcl:"enabled"`
 	CursorPath      string   `hcl:"cursor_path,optional"`
 	CursorSync      int      `hcl:"cursor_sync,optional"`
 	IgnoredServices []string `hcl:"ignored_services,optional"`
+
+	// only read entries from these units
+	Units []string `hcl:"units,optional"`
+	// a single priority or range, e.g. "warning" or "0..4"
+	Priority string `hcl:"priority,optional"`
+	// FIELD=VALUE matches as accepted by journalctl
+	Matches []string `hcl:"matches,optional"`
+	// journal fields kept as tags on each entry
+	Fields []string `hcl:"fields,optional"`
 }
 
+// LogFileFormats are the values accepted for the format of a log_file block, an
+// empty format keeps each line as is
+var LogFileFormats = []string{"", "json", "logfmt", "regex", "syslog", "nginx_combined", "apache_combined", "audit"}
+
 type LogFileBlock struct {
 	Path    string `hcl:"path,label"`
 	Service string `hcl:"service,optional"`
 	Level   string `hcl:"level,optional"`
 	Format  string `hcl:"format,optional"`
+
+	// regular expression with named groups used by the regex format
+	Pattern    string `hcl:"pattern,optional"`
+	TimeFormat string `hcl:"time_format,optional"`
+
+	// override which parsed fields are mapped onto the log entry
+	LevelField   string `hcl:"level_field,optional"`
+	TimeField    string `hcl:"time_field,optional"`
+	ServiceField string `hcl:"service_field,optional"`
+	MessageField string `hcl:"message_field,optional"`
+	// parsed fields kept as tags, all other fields remain part of the data
+	TagFields []string `hcl:"tag_fields,optional"`
+
+	Multiline *LogFileMultilineBlock `hcl:"multiline,block"`
+}
+
+// LogFileMultilineBlock merges continuation lines (e.g. stack traces) into the
+// previous entry, exactly one of the patterns must be provided.
+type LogFileMultilineBlock struct {
+	// lines matching start a new entry, all others are continuations
+	StartPattern string `hcl:"start_pattern,optional"`
+	// lines matching are continuations, all others start a new entry
+	ContinuationPattern string `hcl:"continuation_pattern,optional"`
+
+	MaxLines     int    `hcl:"max_lines,optional"`
+	MaxBytes     int    `hcl:"max_bytes,optional"`
+	FlushTimeout string `hcl:"flush_timeout,optional"`
+}
+
+// LogMetricConfig derives a metric from log entries matching a pattern
+type LogMetricConfig struct {
+	Name    string `hcl:"name,label"`
+	Service string `hcl:"service,optional"`
+	Pattern string `hcl:"pattern"`
+
+	// one of counter (default), gauge or histogram
+	Type string `hcl:"type,optional"`
+	// named group holding the numeric value for gauges and histograms
+	Value   string    `hcl:"value,optional"`
+	Buckets []float64 `hcl:"buckets,optional"`
+
+	// named groups to use as tags, defaults to all named groups
+	TagGroups []string          `hcl:"tag_groups,optional"`
+	Tags      map[string]string `hcl:"tags,optional"`
 }
 
 type PrometheusScraperConfig struct {
 	URL      string            `hcl:"url"`
 	Interval string            `hcl:"interval"`
 	Timeout  string            `hcl:"timeout,optional"`
+	Splay    string            `hcl:"splay,optional"`
 	Prefix   string            `hcl:"prefix,optional"`
 	Tags     map[string]string `hcl:"tags,optional"`
 }
@@ -80,13 +244,105 @@ func newHCLEvalContext() *hcl.EvalContext {
 	}
 }
 
+func decodeCollectorBlock(block *hcl.Block, evalCtx *hcl.EvalContext) (CollectorConfig, hcl.Diagnostics) {
+	config := CollectorConfig{Name: block.Labels[0]}
+	if len(block.Labels) > 1 {
+		config.Instance = block.Labels[1]
+	} else {
+		config.Name, config.Instance, _ = strings.Cut(config.Name, "/")
+	}
+
+	diags := gohcl.DecodeBody(block.Body, evalCtx, &config)
+	return config, diags
+}
+
+// decodeCollectorBlocks decodes the collector blocks of body, which hcl schemas
+// can't express as the second label is optional. the remaining body holds
+// everything else.
+func decodeCollectorBlocks(body hcl.Body, evalCtx *hcl.EvalContext) ([]CollectorConfig, hcl.Body, hcl.Diagnostics) {
+	var collectors []CollectorConfig
+	var diags hcl.Diagnostics
+
+	syntaxBody, ok := body.(*hclsyntax.Body)
+	if !ok {
+		// json has no way to tell labels from attributes, so it is limited to one
+		content, remain, contentDiags := body.PartialContent(&hcl.BodySchema{
+			Blocks: []hcl.BlockHeaderSchema{{Type: "collector", LabelNames: []string{"name"}}},
+		})
+		diags = append(diags, contentDiags...)
+		if content == nil {
+			return nil, remain, diags
+		}
+
+		for _, block := range content.Blocks {
+			config, blockDiags := decodeCollectorBlock(block, evalCtx)
+			diags = append(diags, blockDiags...)
+			collectors = append(collectors, config)
+		}
+		return collectors, remain, diags
+	}
+
+	remain := *syntaxBody
+	remain.Blocks = nil
+	for _, block := range syntaxBody.Blocks {
+		if block.Type != "collector" {
+			remain.Blocks = append(remain.Blocks, block)
+			continue
+		}
+
+		if len(block.Labels) == 0 || len(block.Labels) > 2 {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid collector block",
+				Detail:   "A collector block requires a name label and optionally an instance label.",
+				Subject:  block.DefRange().Ptr(),
+			})
+			continue
+		}
+
+		config, blockDiags := decodeCollectorBlock(block.AsHCLBlock(), evalCtx)
+		diags = append(diags, blockDiags...)
+		collectors = append(collectors, config)
+	}
+	return collectors, &remain, diags
+}
+
 func LoadDaemonConfig(path string) (*DaemonConfig, error) {
-	var cfg DaemonConfig
+	parser := hclparse.NewParser()
+
+	var file *hcl.File
+	var diags hcl.Diagnostics
+	if filepath.Ext(path) == ".json" {
+		file, diags = parser.ParseJSONFile(path)
+	} else {
+		file, diags = parser.ParseHCLFile(path)
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
 	evalCtx := newHCLEvalContext()
-	err := hclsimple.DecodeFile(path, evalCtx, &cfg)
-	if err != nil {
-		return nil, err
+	collectors, body, diags := decodeCollectorBlocks(file.Body, evalCtx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	var cfg DaemonConfig
+	diags = gohcl.DecodeBody(body, evalCtx, &cfg)
+	if diags.HasErrors() {
+		return nil, diags
 	}
+	cfg.Collectors = collectors
+
+	for _, logFile := range cfg.LogFile {
+		if !slices.Contains(LogFileFormats, logFile.Format) {
+			return nil, fmt.Errorf("log_file '%s': unknown format '%s'", logFile.Path, logFile.Format)
+		}
+		if logFile.Format == "regex" && logFile.Pattern == "" {
+			return nil, fmt.Errorf("log_file '%s': regex format requires a pattern", logFile.Path)
+		}
+	}
+
 	return &cfg, nil
 }
 
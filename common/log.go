@@ -9,6 +9,10 @@ type LogEntry struct {
 	Level   string            `json:"l"`
 	Data    string            `json:"d"`
 	Tags    map[string]string `json:"g"`
+
+	// set for entries received from other machines (e.g. via syslog) which keep
+	// their Host, it is never read from json so clients can't spoof the host
+	Relayed bool `json:"-"`
 }
 
 func NewLogEntry(service, data string, tags map[string]string) *LogEntry {
@@ -23,3 +27,21 @@ func NewLogEntry(service, data string, tags map[string]string) *LogEntry {
 		Tags:    tags,
 	}
 }
+
+// PriorityLevel maps a syslog/journald priority (0-7) to a level name
+func PriorityLevel(priority string) string {
+	switch priority {
+	case "0", "1", "2":
+		return "critical"
+	case "3":
+		return "error"
+	case "4":
+		return "warning"
+	case "5", "6":
+		return "info"
+	case "7":
+		return "debug"
+	default:
+		return ""
+	}
+}
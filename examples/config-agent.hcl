@@ -10,6 +10,15 @@ journal {
   // cursors reduce the duplicate log entries that may get sent if the yamon agent crashes 
   cursor_path = "/var/opt/yamon-journal-cursor.txt"
   cursor_sync = 128
+
+  // optionally restrict which entries are read
+  // units    = ["nginx.service", "postgresql.service"]
+  // priority = "0..5"
+  // matches  = ["_TRANSPORT=syslog"]
+
+  // journal fields kept as tags, defaults to the pid, uid, command, transport,
+  // priority, facility, unit and container name
+  fields = ["_SYSTEMD_UNIT", "_PID", "PRIORITY"]
 }
 
 // we can completely disable unwanted collectors
@@ -17,9 +26,165 @@ collector "gpu" {
   disabled = true
 }
 
-// we can configure the interval at which collectors run
-collector "apt" {
+// starlark scripts run inside the agent, avoiding the cost of starting a process
+// on every interval. see examples/qbittorrent.star
+collector "starlark" {
+  interval = "30s"
+  timeout  = "10s"
+
+  script "/etc/yamon/qbittorrent.star" {
+    // available to the script as the config dict
+    vars = {
+      host = "localhost:8080"
+    }
+
+    // files the script may read with file.read
+    allowed_paths = ["/proc/*"]
+  }
+}
+
+// report days until certificates expire, an event is emitted whenever a
+// certificate on disk is replaced
+collector "certs" {
+  interval = "1h"
+
+  files     = ["/etc/letsencrypt/live/*/fullchain.pem", "/etc/ssl/private/*.der"]
+  endpoints = ["example.com:443", "mail.example.com:993"]
+}
+
+// service integrations are configured by dsn or url, tags are added to
+// everything a collector emits
+collector "postgres" {
+  dsn = "postgres://yamon@localhost/postgres?sslmode=disable"
+
+  // bloat is estimated for this many of the largest tables
+  bloat_tables = 20
+
+  tags = {
+    cluster = "main"
+  }
+}
+collector "redis" {
+  url = "redis://:password@localhost:6379"
+}
+collector "nginx" {
+  url = "http://localhost/nginx_status"
+}
+
+// we can configure the interval at which collectors run. collectors run once
+// when the agent starts, after that runs are aligned to the wall clock (every 5
+// minutes on the minute here) and all metrics of a run share its timestamp. a
+// run still going when the next one is due causes that run to be skipped
+// (counted by yamon.scheduler.skipped_runs)
+//
+// packages (which replaced the apt collector and may still be configured as
+// "apt") runs hourly by default, it only reads the local package metadata cache
+collector "packages" {
   interval = "5m"
+
+  // offset runs (including the first) by up to this much, the offset is stable
+  // for each host so a fleet of agents doesn't collect at the same moment
+  splay = "1m"
+
+  // emit an event whenever installed packages change, persisting the last
+  // seen inventory across restarts
+  inventory      = true
+  inventory_path = "/var/opt/yamon-packages.json"
+}
+
+// some collectors accept additional options
+collector "net" {
+  // glob patterns matched against interface names, by default veth* and br-*
+  // interfaces are excluded
+  exclude = ["veth*", "br-*", "docker*"]
+}
+
+// a second label creates another instance of a collector with its own options,
+// everything it emits is tagged with instance = "uplinks" and the static tags
+collector "net" "uplinks" {
+  include  = ["eth*", "enp*"]
+  interval = "1s"
+
+  tags = {
+    role = "uplink"
+  }
+}
+
+collector "disk_usage" {
+  // filesystem types to skip, replaces the default list of pseudo filesystems
+  // exclude_types = ["tmpfs", "proc", "sysfs"]
+
+  // regular expressions matched against mount paths
+  exclude_mounts = ["overlay2", "^/snap/"]
+}
+
+// file_metrics turns arbitrary /proc and sysfs files into metrics, supported
+// formats are key_value, key_equals, kstat, single and table
+collector "file_metrics" {
+  file "/sys/class/net/*/statistics/*" {
+    format = "single"
+    prefix = "net.statistics"
+    type   = "counter"
+
+    // named groups become tags, the "name" group is appended to the prefix
+    path_regex = "^/sys/class/net/(?P<iface>[^/]+)/statistics/(?P<name>[^/]+)$"
+  }
+}
+
+// receive syslog (RFC5424 and RFC3164) from devices which cannot run an agent,
+// entries keep the hostname of the sender
+syslog {
+  udp = ":514"
+  tcp = ":514"
+
+  tls {
+    bind      = ":6514"
+    cert_file = "/etc/yamon/syslog.crt"
+    key_file  = "/etc/yamon/syslog.key"
+  }
+
+  tags = {
+    source = "network"
+  }
+}
+
+// accept statsd and dogstatsd metrics, counters are reported as cumulative
+// totals while timers and sets are aggregated over each flush interval
+statsd {
+  udp      = "127.0.0.1:8125"
+  unixgram = "/run/yamon/statsd.sock"
+
+  flush_interval = "10s"
+  percentiles    = [50, 95, 99.9]
+  prefix         = "app."
+}
+
+// blackbox probes report probe.success and probe.duration_seconds along with
+// type specific metrics, a probe.state event is emitted whenever a probe starts
+// failing or recovers
+probe "http" "homepage" {
+  target   = "https://example.com/"
+  interval = "30s"
+  timeout  = "10s"
+
+  // defaults to any 2xx status
+  expect_status = [200]
+  body_regex    = "Example Domain"
+}
+probe "tcp" "postgres" {
+  target = "db.internal:5432"
+}
+probe "dns" "internal" {
+  target      = "db.internal"
+  server      = "10.0.0.2"
+  record_type = "A"
+  expect      = ["10.0.0.10"]
+}
+// uses unprivileged ping sockets when net.ipv4.ping_group_range allows it,
+// otherwise raw sockets which require CAP_NET_RAW
+probe "icmp" "gateway" {
+  target = "10.0.0.1"
+  count  = 5
 }
 
 // the http server provides access to the agent api
@@ -27,10 +192,39 @@ http {
   bind = "localhost:9877"
 }
 
-// we can use the log_file directive to include log lines from regular files
+// we can use the log_file directive to include log lines from regular files,
+// the read position of each file is stored here so nothing written while yamon
+// is stopped is lost (even if the file was rotated and compressed meanwhile)
+log_file_position_path = "/var/lib/yamon/log-positions.json"
+
 log_file "/var/log/nginx/access.log" {
   service = "nginx"
   level   = "info"
+
+  // structured formats extract fields into the level, time, service and tags
+  // of each entry: json, logfmt, regex, syslog, nginx_combined, apache_combined
+  format = "nginx_combined"
+
+  // only these fields become tags, the others are kept in the data (appended
+  // to the message in logfmt when the format provides a message field)
+  tag_fields = ["method", "status"]
+}
+log_file "/var/log/myapp/app.log" {
+  service = "myapp"
+
+  // merge stack traces into a single entry, lines not starting with a date
+  // are appended to the previous entry
+  multiline {
+    start_pattern = "^\\d{4}-\\d{2}-\\d{2}"
+    max_lines     = 200
+    flush_timeout = "2s"
+  }
+}
+// globs pick up new files as they are created, entries are tagged with the
+// file they were read from
+log_file "/var/log/myapp/jobs/*.log" {
+  service = "myapp-jobs"
+  format  = "json"
 }
 log_file "/var/log/nginx/error.log" {
   service = "nginx"
@@ -39,12 +233,33 @@ log_file "/var/log/nginx/error.log" {
 log_file "/var/log/postgresql/postgresql-12-main.log" {
   service = "postgres"
   level   = "info"
+
+  // the regex format maps named groups onto fields
+  format      = "regex"
+  pattern     = "^(?P<time>\\S+ \\S+ \\S+) \\[(?P<pid>\\d+)\\] (?P<level>[A-Z]+):\\s+(?P<message>.*)$"
+  time_format = "2006-01-02 15:04:05.000 MST"
+}
+
+// metrics can be derived from log entries of any source, named groups in the
+// pattern become tags. series not seen for 20 intervals are dropped and each
+// rule is limited to 10000 series
+log_metric "nginx.requests" {
+  service = "nginx"
+  pattern = "\" (?P<status>\\d{3}) "
+}
+log_metric "postgres.slow_query_ms" {
+  service = "postgres"
+  pattern = "duration: (?P<duration>[0-9.]+) ms"
+  type    = "histogram"
+  value   = "duration"
+  buckets = [10, 50, 100, 500, 1000, 5000]
 }
 
 // we can also scrape prometheus endpoints, in this example we're scraping the yamon server
 prometheus {
   url      = "http://localhost:6691/metrics"
   interval = "15s"
+  splay    = "5s"
   tags = {
     service = "yamon"
   }
@@ -63,6 +278,35 @@ script "/etc/yamon/qbittorrent.ts" {
   // config a timeout (should generally be lower than your interval)
   timeout = "20s"
 
-  // we could set STREAMING=1 above and enable this mode to have the script run and stream data from stdout
+  // scripts are scheduled like collectors, see splay above
+  splay = "10s"
+
+  // we could set STREAMING=1 above and enable this mode to have the script run and stream data from stdout,
+  // one json result per line. streaming scripts are restarted (with a backoff) whenever they exit
   // streaming = true
+
+  // lines written to stderr are sent as log entries tagged with the script path
+
+  // the output format of the script, one of json (the default), ndjson, prometheus, influx
+  // or nagios (the exit status and perfdata become metrics, the status an event on the
+  // first run and whenever it changes). untyped prometheus metrics are written as gauges.
+  // timestamps may be in seconds, milliseconds or nanoseconds
+  // format = "nagios"
+
+  // scripts can be run as another user in their own working directory without
+  // inheriting the environment of the agent
+  // user      = "nobody"
+  // group     = "nogroup"
+  // dir       = "/var/lib/yamon"
+  // clean_env = true
+
+  // resource limits are enforced using a transient cgroup (v2) created below the
+  // agent's own cgroup, which has to be delegated to it (Delegate=yes in the
+  // systemd unit). otherwise only memory_limit is applied (as an rlimit, using
+  // prlimit)
+  memory_limit = "128M"
+  cpu_limit    = 0.5
+
+  // scripts writing more than this to stdout are killed
+  max_output = "1M"
 }
\ No newline at end of file
@@ -1,99 +1,148 @@
 package journal
 
 import (
+	"errors"
 	"log/slog"
+	"time"
 
 	"github.com/b1naryth1ef/yamon/common"
 	"github.com/b1naryth1ef/yamon/journal/journalctl"
 )
 
+// fields kept as tags when no allowlist is configured
+var defaultTagFields = []string{
+	"PRIORITY",
+	"SYSLOG_FACILITY",
+	"_PID",
+	"_UID",
+	"_COMM",
+	"_TRANSPORT",
+	"_SYSTEMD_UNIT",
+	"_SYSTEMD_USER_UNIT",
+	"CONTAINER_NAME",
+}
+
 type JournalClient struct {
 	sink            common.LogSink
 	tracker         JournalTracker
 	ignoredServices map[string]struct{}
+	tagFields       map[string]struct{}
+	opts            journalctl.Opts
 }
 
-func NewJournalClient(sink common.LogSink, tracker JournalTracker, ignoredServices []string) *JournalClient {
+func NewJournalClient(sink common.LogSink, tracker JournalTracker, config *common.DaemonJournalConfig) *JournalClient {
 	ignored := map[string]struct{}{}
-	if ignoredServices != nil {
-		for _, service := range ignoredServices {
-			ignored[service] = struct{}{}
-		}
+	for _, service := range config.IgnoredServices {
+		ignored[service] = struct{}{}
+	}
+
+	fields := config.Fields
+	if fields == nil {
+		fields = defaultTagFields
+	}
+	tagFields := map[string]struct{}{}
+	for _, field := range fields {
+		tagFields[field] = struct{}{}
 	}
+
 	return &JournalClient{
 		sink:            sink,
 		tracker:         tracker,
 		ignoredServices: ignored,
+		tagFields:       tagFields,
+		opts: journalctl.Opts{
+			Output:   "json",
+			Follow:   true,
+			Units:    config.Units,
+			Priority: config.Priority,
+			Matches:  config.Matches,
+			OnInvalidJSON: func(data []byte, err error) {
+				slog.Warn("journalctl json parse error", slog.String("data", string(data)), slog.Any("error", err))
+			},
+		},
 	}
 }
 
+// Run follows the journal, restarting journalctl from the last committed
+// cursor whenever it exits.
 func (j *JournalClient) Run() error {
-	lines := 0
-	instance, err := journalctl.New(&journalctl.Opts{
-		Output: "json",
-		Follow: true,
-		Lines:  &lines,
-		OnInvalidJSON: func(data []byte, err error) {
-			slog.Warn("journalctl json parse error", slog.String("data", string(data)), slog.Any("error", err))
-		},
-	})
-	if err != nil {
-		return err
-	}
-
-	entries := instance.Entries()
 	for {
-		entry := <-entries
+		cursor, err := j.tracker.LastCursor()
+		if err != nil {
+			return err
+		}
 
-		service := entry["SYSLOG_IDENTIFIER"]
-		delete(entry, "SYSLOG_IDENTIFIER")
-		if _, ok := j.ignoredServices[service]; ok {
-			continue
+		err = j.follow(cursor)
+		if err != nil {
+			return err
 		}
 
-		message := entry["MESSAGE"]
-		delete(entry, "MESSAGE")
-		delete(entry, "_HOSTNAME")
-		delete(entry, "_SYSTEMD_INVOCATION_ID")
-		delete(entry, "_STREAM_ID")
-		delete(entry, "__MONOTONIC_TIMESTAMP")
+		time.Sleep(time.Second * 5)
+	}
+}
 
-		realtimeTimestamp := entry.RealtimeTimestamp()
-		delete(entry, "__REALTIME_TIMESTAMP")
+// follow runs a single journalctl instance until it exits, the cursor is only
+// reset when journalctl rejects it
+func (j *JournalClient) follow(cursor string) error {
+	opts := j.opts
+	if cursor != "" {
+		opts.AfterCursor = cursor
+	} else {
+		lines := 0
+		opts.Lines = &lines
+	}
 
-		cursor := entry["__CURSOR"]
-		delete(entry, "__CURSOR")
+	instance, err := journalctl.New(&opts)
+	if err != nil {
+		return err
+	}
 
-		logEntry := common.NewLogEntry(
-			service,
-			message,
-			entry,
-		)
+	count := 0
+	for entry := range instance.Entries() {
+		count += 1
 
-		logEntry.Time = realtimeTimestamp
-		logEntry.Level = getLevelName(entry["PRIORITY"])
-		j.sink.WriteLog(logEntry)
+		j.write(entry)
 
-		err = j.tracker.CommitCursor(cursor)
+		err = j.tracker.CommitCursor(entry["__CURSOR"])
 		if err != nil {
+			instance.Close()
+			for range instance.Entries() {
+			}
+			instance.Wait()
 			return err
 		}
 	}
+
+	err = instance.Wait()
+	slog.Warn("journal: journalctl exited", slog.Int("entries", count), slog.Any("error", err))
+
+	if errors.Is(err, journalctl.ErrInvalidCursor) {
+		slog.Warn("journal: resetting cursor rejected by journalctl", slog.String("cursor", cursor))
+		return j.tracker.CommitCursor("")
+	}
+	return nil
 }
 
-func getLevelName(level string) string {
-	switch level {
-	case "0", "1", "2":
-		return "critical"
-	case "3":
-		return "error"
-	case "4":
-		return "warning"
-	case "5", "6":
-		return "info"
-	case "7":
-		return "debug"
-	default:
-		return ""
+func (j *JournalClient) write(entry journalctl.Entry) {
+	service := entry["SYSLOG_IDENTIFIER"]
+	if _, ok := j.ignoredServices[service]; ok {
+		return
+	}
+
+	tags := map[string]string{}
+	for key, value := range entry {
+		if _, ok := j.tagFields[key]; ok {
+			tags[key] = value
+		}
 	}
+
+	logEntry := common.NewLogEntry(
+		service,
+		entry["MESSAGE"],
+		tags,
+	)
+
+	logEntry.Time = entry.RealtimeTimestamp()
+	logEntry.Level = common.PriorityLevel(entry["PRIORITY"])
+	j.sink.WriteLog(logEntry)
 }
@@ -18,7 +18,7 @@ func Run(config *common.DaemonJournalConfig, sink common.Sink) error {
 		tracker = &NoopJournalTracker{}
 	}
 
-	client := NewJournalClient(sink, tracker, config.IgnoredServices)
+	client := NewJournalClient(sink, tracker, config)
 
 	go func() {
 		err := client.Run()
@@ -2,22 +2,83 @@ package journalctl
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os/exec"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type Entry map[string]string
 
+// ErrInvalidCursor is returned by Wait when journalctl could not seek to the
+// cursor passed as AfterCursor
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 func (e Entry) RealtimeTimestamp() time.Time {
-	realtimeTimestamp, _ := strconv.Atoi(e["__REALTIME_TIMESTAMP"])
-	return time.Unix(int64(realtimeTimestamp/1000000), 0)
+	realtimeTimestamp, _ := strconv.ParseInt(e["__REALTIME_TIMESTAMP"], 10, 64)
+	return time.UnixMicro(realtimeTimestamp)
+}
+
+// decodeValue converts a journal field from its json representation, binary
+// fields are encoded as an array of bytes and fields which occur multiple
+// times in an entry as an array of values.
+func decodeValue(data json.RawMessage) (string, bool) {
+	// fields which exceed journalctl's size limit are null
+	if string(data) == "null" {
+		return "", false
+	}
+
+	var str string
+	if json.Unmarshal(data, &str) == nil {
+		return str, true
+	}
+
+	var raw []byte
+	if json.Unmarshal(data, &raw) == nil {
+		if !utf8.Valid(raw) {
+			return "", false
+		}
+		return string(raw), true
+	}
+
+	var values []json.RawMessage
+	if json.Unmarshal(data, &values) == nil {
+		result := make([]string, 0, len(values))
+		for _, value := range values {
+			if str, ok := decodeValue(value); ok {
+				result = append(result, str)
+			}
+		}
+		return strings.Join(result, ","), len(result) > 0
+	}
+
+	return "", false
+}
+
+func decodeEntry(data []byte) (Entry, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := make(Entry, len(fields))
+	for key, value := range fields {
+		if str, ok := decodeValue(value); ok {
+			entry[key] = str
+		}
+	}
+	return entry, nil
 }
 
 type Instance struct {
 	cmd     *exec.Cmd
+	stderr  *bytes.Buffer
 	entries chan Entry
 }
 
@@ -26,6 +87,14 @@ type Opts struct {
 	Follow bool
 	Lines  *int
 
+	// resume after the entry with this cursor
+	AfterCursor string
+	Units       []string
+	// a single priority or range, e.g. "warning" or "0..4"
+	Priority string
+	// FIELD=VALUE matches, see journalctl(1)
+	Matches []string
+
 	OnInvalidJSON func(data []byte, err error)
 }
 
@@ -44,6 +113,23 @@ func New(opts *Opts) (*Instance, error) {
 		cmd.Args = append(cmd.Args, fmt.Sprintf("-n%d", *opts.Lines))
 	}
 
+	if opts.AfterCursor != "" {
+		cmd.Args = append(cmd.Args, "--after-cursor", opts.AfterCursor)
+	}
+
+	for _, unit := range opts.Units {
+		cmd.Args = append(cmd.Args, "--unit", unit)
+	}
+
+	if opts.Priority != "" {
+		cmd.Args = append(cmd.Args, "--priority", opts.Priority)
+	}
+
+	cmd.Args = append(cmd.Args, opts.Matches...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
 	output, err := cmd.StdoutPipe()
 	if err != nil {
 		return nil, err
@@ -57,13 +143,15 @@ func New(opts *Opts) (*Instance, error) {
 	entries := make(chan Entry, 0)
 
 	go func() {
+		defer close(entries)
+
 		scanner := bufio.NewScanner(output)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
 
 		for scanner.Scan() {
 			line := scanner.Bytes()
 
-			entry := map[string]string{}
-			err := json.Unmarshal(line, &entry)
+			entry, err := decodeEntry(line)
 			if err != nil {
 				if opts.OnInvalidJSON != nil {
 					opts.OnInvalidJSON(line, err)
@@ -77,14 +165,31 @@ func New(opts *Opts) (*Instance, error) {
 
 	return &Instance{
 		cmd:     cmd,
+		stderr:  &stderr,
 		entries: entries,
 	}, nil
 }
 
+// Entries is closed once journalctl exits
 func (i *Instance) Entries() <-chan Entry {
 	return i.entries
 }
 
+// Wait returns the exit status of journalctl, it must only be called once
+// Entries has been closed
+func (i *Instance) Wait() error {
+	err := i.cmd.Wait()
+	if err == nil || i.stderr.Len() == 0 {
+		return err
+	}
+
+	stderr := strings.TrimSpace(i.stderr.String())
+	if strings.Contains(stderr, "Failed to seek to cursor") {
+		return fmt.Errorf("%w: %s", ErrInvalidCursor, stderr)
+	}
+	return fmt.Errorf("%v: %s", err, stderr)
+}
+
 func (i *Instance) Close() error {
 	return i.cmd.Process.Kill()
 }
@@ -41,6 +41,11 @@ func (f *FileBasedJournalTracker) CommitCursor(cursor string) error {
 	if err != nil {
 		return err
 	}
+	// cursors vary in length, so drop whatever remains of the previous one
+	err = f.file.Truncate(int64(len(cursor)))
+	if err != nil {
+		return err
+	}
 	f.count += 1
 	if f.sync > 0 && f.count%f.sync == 0 {
 		return f.file.Sync()
@@ -53,7 +58,7 @@ func (f *FileBasedJournalTracker) LastCursor() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	data := make([]byte, 256)
+	data := make([]byte, 512)
 	n, err := f.file.Read(data)
 
 	if err == io.EOF && n == 0 {
@@ -0,0 +1,301 @@
+package yamon
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/b1naryth1ef/yamon/common"
+)
+
+var defaultLogMetricBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+const (
+	// series which have not been observed for this many intervals are dropped
+	logMetricSeriesExpiry = 20
+	// new series of a rule are ignored once it has this many
+	logMetricMaxSeries = 10000
+)
+
+type logMetricSeries struct {
+	tags    map[string]string
+	value   float64
+	updated bool
+	// intervals since the series was last observed
+	idle int
+
+	// histograms only, bucket counts are cumulative
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+type logMetricRule struct {
+	config    common.LogMetricConfig
+	pattern   *regexp.Regexp
+	value     int
+	tagGroups map[int]string
+	buckets   []float64
+
+	// guards series, entries are matched without holding it
+	sync.Mutex
+	series        map[string]*logMetricSeries
+	limitReported bool
+}
+
+func newLogMetricRule(config common.LogMetricConfig) (*logMetricRule, error) {
+	pattern, err := regexp.Compile(config.Pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	rule := &logMetricRule{
+		config:    config,
+		pattern:   pattern,
+		value:     -1,
+		tagGroups: map[int]string{},
+		series:    map[string]*logMetricSeries{},
+	}
+
+	switch config.Type {
+	case "":
+		rule.config.Type = common.MetricTypeCounter
+	case common.MetricTypeCounter, common.MetricTypeGauge, "histogram":
+	default:
+		return nil, fmt.Errorf("invalid type '%s'", config.Type)
+	}
+
+	if rule.config.Type != common.MetricTypeCounter {
+		if config.Value == "" {
+			return nil, fmt.Errorf("%s requires a value group", rule.config.Type)
+		}
+		rule.value = pattern.SubexpIndex(config.Value)
+		if rule.value == -1 {
+			return nil, fmt.Errorf("pattern has no group named '%s'", config.Value)
+		}
+	}
+
+	for idx, name := range pattern.SubexpNames() {
+		if name == "" || idx == rule.value {
+			continue
+		}
+		if config.TagGroups != nil && !slices.Contains(config.TagGroups, name) {
+			continue
+		}
+		rule.tagGroups[idx] = name
+	}
+
+	if rule.config.Type == "histogram" {
+		rule.buckets = config.Buckets
+		if rule.buckets == nil {
+			rule.buckets = defaultLogMetricBuckets
+		}
+		slices.Sort(rule.buckets)
+	}
+
+	return rule, nil
+}
+
+func seriesKey(tags map[string]string) string {
+	parts := make([]string, 0, len(tags))
+	for k, v := range tags {
+		parts = append(parts, k+"="+v)
+	}
+	slices.Sort(parts)
+	return strings.Join(parts, ",")
+}
+
+func (r *logMetricRule) observe(entry *common.LogEntry) {
+	if r.config.Service != "" && r.config.Service != entry.Service {
+		return
+	}
+
+	match := r.pattern.FindStringSubmatch(entry.Data)
+	if match == nil {
+		return
+	}
+
+	value := 1.0
+	if r.value != -1 {
+		v, err := strconv.ParseFloat(match[r.value], 64)
+		if err != nil {
+			return
+		}
+		value = v
+	}
+
+	tags := map[string]string{"service": entry.Service}
+	for k, v := range r.config.Tags {
+		tags[k] = v
+	}
+	for idx, name := range r.tagGroups {
+		tags[name] = match[idx]
+	}
+
+	key := seriesKey(tags)
+
+	r.Lock()
+	defer r.Unlock()
+
+	series, ok := r.series[key]
+	if !ok {
+		if len(r.series) >= logMetricMaxSeries {
+			if !r.limitReported {
+				slog.Warn("log-metric-filter: too many series, ignoring new ones", slog.String("name", r.config.Name), slog.Int("limit", logMetricMaxSeries))
+				r.limitReported = true
+			}
+			return
+		}
+
+		series = &logMetricSeries{tags: tags}
+		if r.buckets != nil {
+			series.buckets = make([]uint64, len(r.buckets))
+		}
+		r.series[key] = series
+	}
+
+	series.updated = true
+	series.idle = 0
+	switch r.config.Type {
+	case common.MetricTypeCounter:
+		series.value += value
+	case common.MetricTypeGauge:
+		series.value = value
+	case "histogram":
+		for idx, bound := range r.buckets {
+			if value <= bound {
+				series.buckets[idx] += 1
+			}
+		}
+		series.sum += value
+		series.count += 1
+	}
+}
+
+func copyTags(tags map[string]string, extra ...string) map[string]string {
+	result := make(map[string]string, len(tags)+len(extra)/2)
+	for k, v := range tags {
+		result[k] = v
+	}
+	for i := 0; i < len(extra); i += 2 {
+		result[extra[i]] = extra[i+1]
+	}
+	return result
+}
+
+func (r *logMetricRule) write(sink common.MetricSink) {
+	name := r.config.Name
+
+	// metrics are written once the lock is released to avoid blocking entries
+	var metrics []*common.Metric
+
+	r.Lock()
+	for key, series := range r.series {
+		switch r.config.Type {
+		case common.MetricTypeCounter:
+			metrics = append(metrics, common.NewCounter(name, series.value, copyTags(series.tags)))
+		case common.MetricTypeGauge:
+			// gauges are only reported while they continue to be observed
+			if series.updated {
+				metrics = append(metrics, common.NewGauge(name, series.value, copyTags(series.tags)))
+			}
+		case "histogram":
+			for idx, bound := range r.buckets {
+				le := strconv.FormatFloat(bound, 'g', -1, 64)
+				metrics = append(metrics, common.NewCounter(name+".bucket", series.buckets[idx], copyTags(series.tags, "le", le)))
+			}
+			metrics = append(metrics,
+				common.NewCounter(name+".bucket", series.count, copyTags(series.tags, "le", "+Inf")),
+				common.NewCounter(name+".sum", series.sum, copyTags(series.tags)),
+				common.NewCounter(name+".count", series.count, copyTags(series.tags)),
+			)
+		}
+		series.updated = false
+
+		series.idle += 1
+		if series.idle >= logMetricSeriesExpiry {
+			delete(r.series, key)
+			r.limitReported = false
+		}
+	}
+	r.Unlock()
+
+	for _, metric := range metrics {
+		sink.WriteMetric(metric)
+	}
+}
+
+// LogMetricFilter derives metrics from the log entries passing through it
+// which are then periodically written to the underlying sink.
+type LogMetricFilter struct {
+	rules    []*logMetricRule
+	interval time.Duration
+	sink     common.Sink
+}
+
+func NewLogMetricFilter(configs []common.LogMetricConfig, interval string, sink common.Sink) (*LogMetricFilter, error) {
+	filter := &LogMetricFilter{
+		interval: time.Second * 15,
+		sink:     sink,
+	}
+
+	if interval != "" {
+		v, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, err
+		}
+		if v <= 0 {
+			return nil, fmt.Errorf("log_metric_interval must be positive")
+		}
+		filter.interval = v
+	}
+
+	for _, config := range configs {
+		rule, err := newLogMetricRule(config)
+		if err != nil {
+			return nil, fmt.Errorf("log_metric '%s': %v", config.Name, err)
+		}
+		filter.rules = append(filter.rules, rule)
+	}
+
+	return filter, nil
+}
+
+func (l *LogMetricFilter) Run() {
+	if len(l.rules) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		start := time.Now()
+
+		for _, rule := range l.rules {
+			rule.write(l.sink)
+		}
+
+		slog.Debug("log-metric-filter: flushed", slog.String("duration", time.Since(start).String()))
+	}
+}
+
+func (l *LogMetricFilter) WriteMetric(metric *common.Metric) {
+	l.sink.WriteMetric(metric)
+}
+
+func (l *LogMetricFilter) WriteLog(entry *common.LogEntry) {
+	for _, rule := range l.rules {
+		rule.observe(entry)
+	}
+	l.sink.WriteLog(entry)
+}
+
+func (l *LogMetricFilter) WriteEvent(event *common.Event) {
+	l.sink.WriteEvent(event)
+}
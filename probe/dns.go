@@ -0,0 +1,119 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/b1naryth1ef/yamon/common"
+)
+
+func normalizeDNSName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+func lookup(ctx context.Context, resolver *net.Resolver, recordType, target string) ([]string, error) {
+	var answers []string
+
+	switch recordType {
+	case "A", "AAAA":
+		network := "ip4"
+		if recordType == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := resolver.LookupIP(ctx, network, target)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			answers = append(answers, ip.String())
+		}
+	case "CNAME":
+		cname, err := resolver.LookupCNAME(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, normalizeDNSName(cname))
+	case "MX":
+		records, err := resolver.LookupMX(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			answers = append(answers, normalizeDNSName(record.Host))
+		}
+	case "NS":
+		records, err := resolver.LookupNS(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			answers = append(answers, normalizeDNSName(record.Host))
+		}
+	case "TXT":
+		return resolver.LookupTXT(ctx, target)
+	}
+
+	return answers, nil
+}
+
+func newDNSCheck(config *common.ProbeConfig) (checkFunc, error) {
+	recordType := strings.ToUpper(config.RecordType)
+	switch recordType {
+	case "":
+		recordType = "A"
+	case "A", "AAAA", "CNAME", "MX", "NS", "TXT":
+	default:
+		return nil, fmt.Errorf("unsupported record type '%s'", config.RecordType)
+	}
+
+	resolver := net.DefaultResolver
+	if config.Server != "" {
+		server := config.Server
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	expected := make([]string, 0, len(config.Expect))
+	for _, answer := range config.Expect {
+		if recordType != "TXT" {
+			answer = normalizeDNSName(answer)
+		}
+		expected = append(expected, answer)
+	}
+
+	return func(ctx context.Context, report *report) error {
+		answers, err := lookup(ctx, resolver, recordType, config.Target)
+		if err != nil {
+			var dnsErr *net.DNSError
+			if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+				report.gauge("probe.dns.answers", 0, "record_type", recordType)
+			}
+			return err
+		}
+
+		report.gauge("probe.dns.answers", float64(len(answers)), "record_type", recordType)
+		if len(answers) == 0 {
+			return fmt.Errorf("no %s records for '%s'", recordType, config.Target)
+		}
+
+		for _, answer := range expected {
+			if !slices.Contains(answers, answer) {
+				return fmt.Errorf("expected answer '%s' not found in %v", answer, answers)
+			}
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,110 @@
+package probe
+
+import (
+	"net"
+	"testing"
+
+	"github.com/b1naryth1ef/yamon/common"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// serveDNS answers A queries for db.test. with 10.0.0.10 and 10.0.0.11,
+// everything else is answered with NXDOMAIN
+func serveDNS(t *testing.T) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buffer := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+
+			var parser dnsmessage.Parser
+			header, err := parser.Start(buffer[:n])
+			if err != nil {
+				continue
+			}
+			question, err := parser.Question()
+			if err != nil {
+				continue
+			}
+
+			header.Response = true
+			header.Authoritative = true
+			builder := dnsmessage.NewBuilder(nil, header)
+			builder.EnableCompression()
+			builder.StartQuestions()
+			builder.Question(question)
+			builder.StartAnswers()
+
+			if question.Name.String() == "db.test." && question.Type == dnsmessage.TypeA {
+				for _, ip := range [][4]byte{{10, 0, 0, 10}, {10, 0, 0, 11}} {
+					builder.AResource(dnsmessage.ResourceHeader{
+						Name:  question.Name,
+						Class: dnsmessage.ClassINET,
+						TTL:   60,
+					}, dnsmessage.AResource{A: ip})
+				}
+			} else if question.Name.String() != "db.test." {
+				header.RCode = dnsmessage.RCodeNameError
+				builder = dnsmessage.NewBuilder(nil, header)
+				builder.StartQuestions()
+				builder.Question(question)
+			}
+
+			response, err := builder.Finish()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(response, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestDNSProbe(t *testing.T) {
+	server := serveDNS(t)
+
+	tests := []struct {
+		name    string
+		target  string
+		expect  []string
+		success bool
+		answers float64
+	}{
+		{"resolves", "db.test", nil, true, 2},
+		{"expected answer", "db.test", []string{"10.0.0.11"}, true, 2},
+		{"unexpected answer", "db.test", []string{"10.0.0.12"}, false, 2},
+		{"not found", "missing.test", nil, false, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sink := runProbe(t, &common.ProbeConfig{
+				Name:   "dns",
+				Type:   "dns",
+				Target: test.target,
+				Server: server,
+				Expect: test.expect,
+			})
+			expectSuccess(t, sink, test.success)
+
+			answers, ok := sink.value("probe.dns.answers")
+			if !ok {
+				t.Fatal("no probe.dns.answers metric written")
+			}
+			if answers != test.answers {
+				t.Fatalf("got %v answers, want %v", answers, test.answers)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/b1naryth1ef/yamon/common"
+)
+
+// only this much of the body is matched against body_regex
+const maxHTTPBodyBytes = 1024 * 1024
+
+func newHTTPCheck(config *common.ProbeConfig) (checkFunc, error) {
+	method := config.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var bodyRegex *regexp.Regexp
+	if config.BodyRegex != "" {
+		var err error
+		bodyRegex, err = regexp.Compile(config.BodyRegex)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			DisableKeepAlives: true,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: config.InsecureSkipVerify,
+			},
+		},
+	}
+
+	return func(ctx context.Context, report *report) error {
+		var dnsStart, dnsDone, connectStart, connectDone, tlsStart, tlsDone, firstByte time.Time
+		trace := &httptrace.ClientTrace{
+			DNSStart:             func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+			DNSDone:              func(httptrace.DNSDoneInfo) { dnsDone = time.Now() },
+			ConnectStart:         func(string, string) { connectStart = time.Now() },
+			ConnectDone:          func(string, string, error) { connectDone = time.Now() },
+			TLSHandshakeStart:    func() { tlsStart = time.Now() },
+			TLSHandshakeDone:     func(tls.ConnectionState, error) { tlsDone = time.Now() },
+			GotFirstResponseByte: func() { firstByte = time.Now() },
+		}
+
+		req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), method, config.Target, nil)
+		if err != nil {
+			return err
+		}
+		for k, v := range config.Headers {
+			req.Header.Set(k, v)
+		}
+
+		start := time.Now()
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		body, err := io.ReadAll(io.LimitReader(res.Body, maxHTTPBodyBytes))
+		if err != nil {
+			return err
+		}
+		end := time.Now()
+
+		phase := func(name string, from, to time.Time) {
+			if !from.IsZero() && !to.IsZero() {
+				report.gauge("probe.http.phase_seconds", to.Sub(from).Seconds(), "phase", name)
+			}
+		}
+		phase("dns", dnsStart, dnsDone)
+		phase("connect", connectStart, connectDone)
+		phase("tls", tlsStart, tlsDone)
+		phase("first_byte", start, firstByte)
+		phase("transfer", firstByte, end)
+
+		report.gauge("probe.http.status_code", float64(res.StatusCode))
+		report.gauge("probe.http.content_length", float64(len(body)))
+
+		if res.TLS != nil && len(res.TLS.PeerCertificates) > 0 {
+			expiry := res.TLS.PeerCertificates[0].NotAfter
+			report.gauge("probe.http.tls_expiry_days", time.Until(expiry).Hours()/24)
+		}
+
+		if config.ExpectStatus != nil {
+			if !slices.Contains(config.ExpectStatus, res.StatusCode) {
+				return fmt.Errorf("unexpected status code %d", res.StatusCode)
+			}
+		} else if res.StatusCode < 200 || res.StatusCode > 299 {
+			return fmt.Errorf("unexpected status code %d", res.StatusCode)
+		}
+
+		if bodyRegex != nil && !bodyRegex.Match(body) {
+			return fmt.Errorf("body did not match '%s'", config.BodyRegex)
+		}
+
+		return nil
+	}, nil
+}
@@ -0,0 +1,123 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/b1naryth1ef/yamon/common"
+)
+
+type testSink struct {
+	metrics []*common.Metric
+	events  []*common.Event
+}
+
+func (t *testSink) WriteMetric(metric *common.Metric) { t.metrics = append(t.metrics, metric) }
+func (t *testSink) WriteLog(entry *common.LogEntry)   {}
+func (t *testSink) WriteEvent(event *common.Event)    { t.events = append(t.events, event) }
+
+func (t *testSink) value(name string) (float64, bool) {
+	for _, metric := range t.metrics {
+		if metric.Name == name {
+			return metric.Value, true
+		}
+	}
+	return 0, false
+}
+
+// runProbe runs a single check of the probe and returns what it wrote
+func runProbe(t *testing.T, config *common.ProbeConfig) *testSink {
+	t.Helper()
+
+	probe, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &testSink{}
+	probe.run(context.Background(), sink)
+	return sink
+}
+
+func expectSuccess(t *testing.T, sink *testSink, want bool) {
+	t.Helper()
+
+	value, ok := sink.value("probe.success")
+	if !ok {
+		t.Fatal("no probe.success metric written")
+	}
+	if (value == 1) != want {
+		t.Fatalf("got probe.success %v, want %v", value, want)
+	}
+}
+
+func TestHTTPProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/header":
+			w.Write([]byte(r.Header.Get("X-Probe")))
+		default:
+			w.Write([]byte("hello from yamon"))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		config  common.ProbeConfig
+		success bool
+	}{
+		{"ok", common.ProbeConfig{Target: server.URL}, true},
+		{"status", common.ProbeConfig{Target: server.URL + "/missing"}, false},
+		{"expect status", common.ProbeConfig{Target: server.URL + "/missing", ExpectStatus: []int{404}}, true},
+		{"body regex", common.ProbeConfig{Target: server.URL, BodyRegex: "from \\w+$"}, true},
+		{"body regex mismatch", common.ProbeConfig{Target: server.URL, BodyRegex: "^goodbye"}, false},
+		{"headers", common.ProbeConfig{Target: server.URL + "/header", Headers: map[string]string{"X-Probe": "yes"}, BodyRegex: "^yes$"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := test.config
+			config.Name = strings.ReplaceAll(test.name, " ", "_")
+			config.Type = "http"
+
+			sink := runProbe(t, &config)
+			expectSuccess(t, sink, test.success)
+
+			if _, ok := sink.value("probe.http.status_code"); !ok {
+				t.Fatal("no probe.http.status_code metric written")
+			}
+		})
+	}
+}
+
+func TestHTTPProbeStateEvents(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	probe, err := New(&common.ProbeConfig{Name: "state", Type: "http", Target: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &testSink{}
+	probe.run(context.Background(), sink)
+	probe.run(context.Background(), sink)
+	if len(sink.events) != 0 {
+		t.Fatalf("got %d events without a state change", len(sink.events))
+	}
+
+	status = http.StatusInternalServerError
+	probe.run(context.Background(), sink)
+	if len(sink.events) != 1 || sink.events[0].Type != "probe.state" {
+		t.Fatalf("got events %v, want a single probe.state event", sink.events)
+	}
+}
@@ -0,0 +1,186 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/b1naryth1ef/yamon/common"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	protocolICMP     = 1
+	protocolICMPv6   = 58
+	icmpPingInterval = time.Millisecond * 200
+)
+
+// shared between all probes so raw sockets (which receive every reply) can
+// tell their replies apart
+var icmpSequence atomic.Uint32
+
+type pingConn struct {
+	conn       *icmp.PacketConn
+	addr       net.Addr
+	protocol   int
+	echoType   icmp.Type
+	replyType  icmp.Type
+	privileged bool
+}
+
+// listenPing prefers unprivileged ping sockets (net.ipv4.ping_group_range),
+// falling back to raw sockets which require CAP_NET_RAW
+func listenPing(ip net.IP) (*pingConn, error) {
+	ping := &pingConn{
+		protocol:  protocolICMP,
+		echoType:  ipv4.ICMPTypeEcho,
+		replyType: ipv4.ICMPTypeEchoReply,
+	}
+	network, rawNetwork, address := "udp4", "ip4:icmp", "0.0.0.0"
+	if ip.To4() == nil {
+		ping.protocol = protocolICMPv6
+		ping.echoType = ipv6.ICMPTypeEchoRequest
+		ping.replyType = ipv6.ICMPTypeEchoReply
+		network, rawNetwork, address = "udp6", "ip6:ipv6-icmp", "::"
+	}
+
+	conn, err := icmp.ListenPacket(network, address)
+	if err == nil {
+		ping.conn = conn
+		ping.addr = &net.UDPAddr{IP: ip}
+		return ping, nil
+	}
+
+	conn, rawErr := icmp.ListenPacket(rawNetwork, address)
+	if rawErr != nil {
+		return nil, errors.Join(err, rawErr)
+	}
+	ping.conn = conn
+	ping.addr = &net.IPAddr{IP: ip}
+	ping.privileged = true
+	return ping, nil
+}
+
+// echo sends a single echo request and waits for its reply
+func (p *pingConn) echo(ctx context.Context, timeout time.Duration) (time.Duration, error) {
+	id := os.Getpid() & 0xffff
+	seq := int(icmpSequence.Add(1) & 0xffff)
+
+	message := icmp.Message{
+		Type: p.echoType,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("yamon")},
+	}
+	data, err := message.Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	p.conn.SetReadDeadline(deadline)
+
+	start := time.Now()
+	_, err = p.conn.WriteTo(data, p.addr)
+	if err != nil {
+		return 0, err
+	}
+
+	buffer := make([]byte, 1500)
+	for {
+		n, _, err := p.conn.ReadFrom(buffer)
+		if err != nil {
+			return 0, err
+		}
+
+		reply, err := icmp.ParseMessage(p.protocol, buffer[:n])
+		if err != nil || reply.Type != p.replyType {
+			continue
+		}
+
+		body, ok := reply.Body.(*icmp.Echo)
+		// the kernel assigns the id of unprivileged ping sockets
+		if !ok || body.Seq != seq || (p.privileged && body.ID != id) {
+			continue
+		}
+		return time.Since(start), nil
+	}
+}
+
+func newICMPCheck(config *common.ProbeConfig) (checkFunc, error) {
+	count := config.Count
+	if count <= 0 {
+		count = 3
+	}
+
+	return func(ctx context.Context, report *report) error {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, config.Target)
+		if err != nil {
+			return err
+		}
+		ip := addrs[0].IP
+		for _, addr := range addrs {
+			if addr.IP.To4() != nil {
+				ip = addr.IP
+				break
+			}
+		}
+
+		ping, err := listenPing(ip)
+		if err != nil {
+			return err
+		}
+		defer ping.conn.Close()
+
+		// split the timeout between all echo requests
+		timeout := time.Second
+		if deadline, ok := ctx.Deadline(); ok {
+			timeout = time.Until(deadline) / time.Duration(count)
+		}
+
+		var sent int
+		var rtts []time.Duration
+		for i := 0; i < count && ctx.Err() == nil; i++ {
+			if i > 0 {
+				select {
+				case <-ctx.Done():
+				case <-time.After(icmpPingInterval):
+				}
+			}
+
+			sent++
+			rtt, err := ping.echo(ctx, timeout)
+			if err == nil {
+				rtts = append(rtts, rtt)
+			}
+		}
+
+		report.gauge("probe.icmp.sent", float64(sent))
+		report.gauge("probe.icmp.received", float64(len(rtts)))
+		if sent > 0 {
+			report.gauge("probe.icmp.loss_ratio", float64(sent-len(rtts))/float64(sent))
+		}
+
+		if len(rtts) == 0 {
+			return fmt.Errorf("no replies from %s", ip)
+		}
+
+		minRTT, maxRTT, sum := rtts[0], rtts[0], time.Duration(0)
+		for _, rtt := range rtts {
+			minRTT = min(minRTT, rtt)
+			maxRTT = max(maxRTT, rtt)
+			sum += rtt
+		}
+		report.gauge("probe.icmp.rtt_seconds", minRTT.Seconds(), "stat", "min")
+		report.gauge("probe.icmp.rtt_seconds", (sum / time.Duration(len(rtts))).Seconds(), "stat", "avg")
+		report.gauge("probe.icmp.rtt_seconds", maxRTT.Seconds(), "stat", "max")
+		return nil
+	}, nil
+}
@@ -0,0 +1,166 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/b1naryth1ef/yamon/common"
+	"github.com/b1naryth1ef/yamon/scheduler"
+)
+
+// checkFunc performs a single probe, any metrics specific to the probe type
+// are added to the report. A non-nil error marks the probe as failed.
+type checkFunc func(ctx context.Context, report *report) error
+
+type report struct {
+	tags    map[string]string
+	metrics []*common.Metric
+}
+
+func (r *report) gauge(name string, value float64, extraTags ...string) {
+	tags := make(map[string]string, len(r.tags)+len(extraTags)/2)
+	for k, v := range r.tags {
+		tags[k] = v
+	}
+	for i := 0; i+1 < len(extraTags); i += 2 {
+		tags[extraTags[i]] = extraTags[i+1]
+	}
+	r.metrics = append(r.metrics, common.NewGauge(name, value, tags))
+}
+
+type stateTransition struct {
+	Probe    string `json:"probe"`
+	Type     string `json:"type"`
+	Target   string `json:"target"`
+	Success  bool   `json:"success"`
+	Previous bool   `json:"previous"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Probe periodically checks a target, reporting whether it succeeded and how
+// long it took along with an event whenever the outcome changes.
+type Probe struct {
+	config   *common.ProbeConfig
+	interval time.Duration
+	timeout  time.Duration
+	check    checkFunc
+	tags     map[string]string
+	schedule *scheduler.Scheduler
+
+	hasState bool
+	success  bool
+}
+
+func New(config *common.ProbeConfig) (*Probe, error) {
+	probe := &Probe{
+		config:   config,
+		interval: time.Second * 30,
+		timeout:  time.Second * 5,
+		tags: map[string]string{
+			"probe":  config.Name,
+			"type":   config.Type,
+			"target": config.Target,
+		},
+	}
+	for k, v := range config.Tags {
+		probe.tags[k] = v
+	}
+
+	var err error
+	if config.Interval != "" {
+		probe.interval, err = time.ParseDuration(config.Interval)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.Timeout != "" {
+		probe.timeout, err = time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	probe.timeout = min(probe.timeout, probe.interval)
+
+	var splay time.Duration
+	if config.Splay != "" {
+		splay, err = time.ParseDuration(config.Splay)
+		if err != nil {
+			return nil, err
+		}
+	}
+	probe.schedule, err = scheduler.New("probe/"+config.Name, probe.interval, probe.timeout, splay)
+	if err != nil {
+		return nil, fmt.Errorf("probe '%s': %v", config.Name, err)
+	}
+
+	switch config.Type {
+	case "http":
+		probe.check, err = newHTTPCheck(config)
+	case "tcp":
+		probe.check, err = newTCPCheck(config)
+	case "dns":
+		probe.check, err = newDNSCheck(config)
+	case "icmp":
+		probe.check, err = newICMPCheck(config)
+	default:
+		err = fmt.Errorf("unknown probe type '%s'", config.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("probe '%s': %v", config.Name, err)
+	}
+
+	return probe, nil
+}
+
+func (p *Probe) Run(ctx context.Context, sink common.Sink) {
+	p.schedule.Run(ctx, sink, p.run)
+}
+
+func (p *Probe) run(ctx context.Context, sink common.Sink) {
+	report := &report{tags: p.tags}
+	start := time.Now()
+	err := p.check(ctx, report)
+	duration := time.Since(start)
+
+	success := err == nil
+	if err != nil {
+		slog.Debug("probe: check failed", slog.String("probe", p.config.Name), slog.Any("error", err))
+	}
+
+	successValue := 0.0
+	if success {
+		successValue = 1
+	}
+	report.gauge("probe.success", successValue)
+	report.gauge("probe.duration_seconds", duration.Seconds())
+
+	for _, metric := range report.metrics {
+		sink.WriteMetric(metric)
+	}
+
+	if p.hasState && p.success != success {
+		transition := stateTransition{
+			Probe:    p.config.Name,
+			Type:     p.config.Type,
+			Target:   p.config.Target,
+			Success:  success,
+			Previous: p.success,
+		}
+		if err != nil {
+			transition.Error = err.Error()
+		}
+		sink.WriteEvent(common.NewEventJSON("probe.state", transition, copyTags(p.tags)))
+	}
+	p.hasState = true
+	p.success = success
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	result := make(map[string]string, len(tags))
+	for k, v := range tags {
+		result[k] = v
+	}
+	return result
+}
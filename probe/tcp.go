@@ -0,0 +1,30 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/b1naryth1ef/yamon/common"
+)
+
+func newTCPCheck(config *common.ProbeConfig) (checkFunc, error) {
+	_, _, err := net.SplitHostPort(config.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, report *report) error {
+		var dialer net.Dialer
+
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", config.Target)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+
+		report.gauge("probe.tcp.connect_seconds", time.Since(start).Seconds())
+		return nil
+	}, nil
+}
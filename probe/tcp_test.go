@@ -0,0 +1,42 @@
+package probe
+
+import (
+	"net"
+	"testing"
+
+	"github.com/b1naryth1ef/yamon/common"
+)
+
+func TestTCPProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	sink := runProbe(t, &common.ProbeConfig{Name: "open", Type: "tcp", Target: listener.Addr().String()})
+	expectSuccess(t, sink, true)
+	if _, ok := sink.value("probe.tcp.connect_seconds"); !ok {
+		t.Fatal("no probe.tcp.connect_seconds metric written")
+	}
+
+	// nothing listens on the port once the listener is closed
+	listener.Close()
+	sink = runProbe(t, &common.ProbeConfig{Name: "closed", Type: "tcp", Target: listener.Addr().String()})
+	expectSuccess(t, sink, false)
+}
+
+func TestTCPProbeInvalidTarget(t *testing.T) {
+	_, err := New(&common.ProbeConfig{Name: "invalid", Type: "tcp", Target: "localhost"})
+	if err == nil {
+		t.Fatal("expected an error for a target without a port")
+	}
+}
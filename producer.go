@@ -8,6 +8,7 @@ import (
 
 	"github.com/b1naryth1ef/yamon/collector"
 	"github.com/b1naryth1ef/yamon/common"
+	"github.com/b1naryth1ef/yamon/scheduler"
 )
 
 type Producer struct {
@@ -22,22 +23,20 @@ func NewProducer(sink common.Sink, collectors []common.CollectorConfig) *Produce
 	}
 }
 
-func (p *Producer) runCollector(col collector.Collector, interval, timeout time.Duration) {
-	collect := func() {
-		ctx, cancel := context.WithTimeout(context.Background(), timeout)
-		defer cancel()
+func collectorName(config common.CollectorConfig) string {
+	if config.Instance == "" {
+		return config.Name
+	}
+	return config.Name + "/" + config.Instance
+}
 
-		err := col.Collect(ctx, p.sink)
+func (p *Producer) runCollector(name string, col collector.Collector, sink common.Sink, schedule *scheduler.Scheduler) {
+	schedule.Run(context.Background(), sink, func(ctx context.Context, sink common.Sink) {
+		err := col.Collect(ctx, sink)
 		if err != nil {
-			slog.Warn("producer.collector.failed", "collector", col, "error", err)
+			slog.Warn("producer.collector.failed", "collector", name, "error", err)
 		}
-	}
-
-	for {
-		collect()
-
-		time.Sleep(interval)
-	}
+	})
 }
 
 func (p *Producer) Start() error {
@@ -46,7 +45,16 @@ func (p *Producer) Start() error {
 			continue
 		}
 
+		name := collectorName(col)
+		inst, err := collector.Registry.New(col.Name, col.Instance, col.Options)
+		if err != nil {
+			return fmt.Errorf("failed to configure collector '%s': %v", name, err)
+		}
+
 		interval := time.Second * 5
+		if periodic, ok := inst.(collector.Periodic); ok {
+			interval = periodic.DefaultInterval()
+		}
 		if col.Interval != "" {
 			v, err := time.ParseDuration(col.Interval)
 			if err != nil {
@@ -64,12 +72,34 @@ func (p *Producer) Start() error {
 			timeout = v
 		}
 
-		inst := collector.Registry.Get(col.Name)
-		if inst == nil {
-			return fmt.Errorf("no such collector '%s'", col.Name)
+		var splay time.Duration
+		if col.Splay != "" {
+			v, err := time.ParseDuration(col.Splay)
+			if err != nil {
+				return err
+			}
+			splay = v
+		}
+
+		tags := col.Tags
+		if col.Instance != "" {
+			tags = map[string]string{"instance": col.Instance}
+			for k, v := range col.Tags {
+				tags[k] = v
+			}
+		}
+
+		var sink common.Sink = p.sink
+		if len(tags) > 0 {
+			sink = NewSinkTagFilter(tags, sink)
+		}
+
+		schedule, err := scheduler.New(name, interval, timeout, splay)
+		if err != nil {
+			return fmt.Errorf("collector '%s': %v", name, err)
 		}
 
-		go p.runCollector(inst, interval, timeout)
+		go p.runCollector(name, inst, sink, schedule)
 	}
 
 	return nil
@@ -1,18 +1,21 @@
 package prom
 
 import (
+	"context"
+	"io"
 	"log/slog"
 	"math"
 	"net/http"
 	"time"
 
 	"github.com/b1naryth1ef/yamon/common"
+	"github.com/b1naryth1ef/yamon/scheduler"
 	"github.com/prometheus/common/expfmt"
 )
 
 type Scraper struct {
 	config   common.PrometheusScraperConfig
-	interval time.Duration
+	schedule *scheduler.Scheduler
 
 	http http.Client
 }
@@ -33,42 +36,75 @@ func NewScraper(config common.PrometheusScraperConfig) (*Scraper, error) {
 		timeout = time.Second * 5
 	}
 
+	var splay time.Duration
+	if config.Splay != "" {
+		splay, err = time.ParseDuration(config.Splay)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	schedule, err := scheduler.New(config.URL, interval, timeout, splay)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Scraper{
 		config:   config,
-		interval: interval,
-		http: http.Client{
-			Timeout: timeout,
-		},
+		schedule: schedule,
 	}, nil
 }
 
-func (s *Scraper) Run(sink common.MetricSink) {
-	for {
-		s.scrape(sink)
-		time.Sleep(s.interval)
-	}
+func (s *Scraper) Run(ctx context.Context, sink common.Sink) {
+	s.schedule.Run(ctx, sink, s.scrape)
 }
 
-func (s *Scraper) scrape(sink common.MetricSink) {
-	res, err := s.http.Get(s.config.URL)
+func (s *Scraper) scrape(ctx context.Context, sink common.Sink) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.config.URL, nil)
+	if err != nil {
+		slog.Error("failed to prom scrape", slog.String("url", s.config.URL), slog.Any("error", err))
+		return
+	}
+
+	res, err := s.http.Do(req)
 	if err != nil {
 		slog.Error("failed to prom scrape", slog.String("url", s.config.URL), slog.Any("error", err))
 		return
 	}
 	defer res.Body.Close()
 
-	var parser expfmt.TextParser
-	mf, err := parser.TextToMetricFamilies(res.Body)
+	err = WriteText(res.Body, TextOptions{Prefix: s.config.Prefix, Tags: s.config.Tags}, sink)
 	if err != nil {
 		slog.Error("failed to parse prom metric data", slog.String("url", s.config.URL), slog.Any("error", err))
 		return
 	}
+}
+
+// TextOptions controls how WriteText converts metrics
+type TextOptions struct {
+	Prefix string
+	Tags   map[string]string
+
+	// write untyped metrics as gauges instead of skipping them
+	Untyped bool
+	// keep the timestamps of samples instead of using the current time
+	Timestamps bool
+}
+
+// WriteText parses metrics in the prometheus text exposition format and writes
+// them to sink.
+func WriteText(reader io.Reader, options TextOptions, sink common.MetricSink) error {
+	var parser expfmt.TextParser
+	mf, err := parser.TextToMetricFamilies(reader)
+	if err != nil {
+		return err
+	}
 
 	for _, metricFamily := range mf {
 		for _, metric := range metricFamily.Metric {
 			tags := map[string]string{}
-			if s.config.Tags != nil {
-				for k, v := range s.config.Tags {
+			if options.Tags != nil {
+				for k, v := range options.Tags {
 					tags[k] = v
 				}
 			}
@@ -77,25 +113,31 @@ func (s *Scraper) scrape(sink common.MetricSink) {
 			}
 
 			name := metricFamily.GetName()
-			if s.config.Prefix != "" {
-				name = s.config.Prefix + name
+			if options.Prefix != "" {
+				name = options.Prefix + name
 			}
 
+			var entry *common.Metric
 			if metric.Gauge != nil {
-				value := metric.Gauge.GetValue()
-				if math.IsNaN(value) {
-					continue
-				}
-				sink.WriteMetric(common.NewGauge(name, value, tags))
+				entry = common.NewGauge(name, metric.Gauge.GetValue(), tags)
 			} else if metric.Counter != nil {
-				value := metric.Counter.GetValue()
-				if math.IsNaN(value) {
-					continue
-				}
-				sink.WriteMetric(common.NewCounter(name, value, tags))
+				entry = common.NewCounter(name, metric.Counter.GetValue(), tags)
+			} else if metric.Untyped != nil && options.Untyped {
+				entry = common.NewGauge(name, metric.Untyped.GetValue(), tags)
 			} else {
 				slog.Debug("skipping unsupported prom metric type", slog.String("name", *metricFamily.Name), slog.Any("type", metricFamily.Type))
+				continue
 			}
+
+			if math.IsNaN(entry.Value) {
+				continue
+			}
+			if metric.TimestampMs != nil && options.Timestamps {
+				entry.Time = time.UnixMilli(metric.GetTimestampMs())
+			}
+			sink.WriteMetric(entry)
 		}
 	}
+
+	return nil
 }
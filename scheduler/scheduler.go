@@ -0,0 +1,137 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/b1naryth1ef/yamon/common"
+)
+
+// Func performs a single run of a scheduled task, it should stop once ctx is
+// done
+type Func func(ctx context.Context, sink common.Sink)
+
+// Scheduler runs a task once when started and then on ticks aligned to the
+// wall clock (e.g. every full minute for an interval of 1m), optionally offset
+// by a splay so that a fleet of agents does not run the task at the same
+// moment. A tick arriving while the previous run is still going is skipped and
+// counted.
+type Scheduler struct {
+	name     string
+	interval time.Duration
+	timeout  time.Duration
+	offset   time.Duration
+
+	skipped uint64
+}
+
+// New creates a scheduler for the named task. The offset within the interval
+// is picked from [0, splay) based on the hostname and task name, keeping it
+// stable across restarts. A timeout of zero disables the timeout.
+func New(name string, interval, timeout, splay time.Duration) (*Scheduler, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive, got %v", interval)
+	}
+	if timeout < 0 || splay < 0 {
+		return nil, fmt.Errorf("timeout and splay can't be negative")
+	}
+
+	scheduler := &Scheduler{
+		name:     name,
+		interval: interval,
+		timeout:  timeout,
+	}
+
+	if splay > 0 {
+		hostname, _ := os.Hostname()
+		hash := fnv.New64a()
+		hash.Write([]byte(hostname + "\x00" + name))
+		scheduler.offset = time.Duration(hash.Sum64() % uint64(min(splay, interval)))
+	}
+
+	return scheduler, nil
+}
+
+// next returns the first tick after now
+func (s *Scheduler) next(now time.Time) time.Time {
+	next := now.Truncate(s.interval).Add(s.offset)
+	for !next.After(now) {
+		next = next.Add(s.interval)
+	}
+	return next
+}
+
+// Run calls fn on every tick until ctx is done, waiting for the current run
+// to return before returning itself. The first run happens right away, or
+// after the offset of the task when a splay is set.
+func (s *Scheduler) Run(ctx context.Context, sink common.Sink, fn Func) {
+	var running atomic.Bool
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	tick := time.Now().Add(s.offset)
+	for {
+		timer := time.NewTimer(time.Until(tick))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			// both may be ready at once, never start a run once ctx is done
+			if ctx.Err() != nil {
+				return
+			}
+		}
+
+		if running.Load() {
+			s.skipped++
+			slog.Warn("scheduler: previous run has not finished, skipping", slog.String("task", s.name), slog.Uint64("skipped", s.skipped))
+			sink.WriteMetric(common.NewCounter("yamon.scheduler.skipped_runs", s.skipped, map[string]string{"task": s.name}))
+			tick = s.next(time.Now())
+			continue
+		}
+
+		running.Store(true)
+		wg.Add(1)
+		go func(tick time.Time) {
+			defer wg.Done()
+			defer running.Store(false)
+			s.run(ctx, tick, sink, fn)
+		}(tick)
+
+		tick = s.next(time.Now())
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, tick time.Time, sink common.Sink, fn Func) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	fn(ctx, &runSink{Sink: sink, time: tick, start: time.Now()})
+}
+
+// runSink stamps every metric created during a run with the time of its tick,
+// so that all metrics of a run share one timestamp. Metrics carrying an
+// earlier timestamp (e.g. from a script) keep it.
+type runSink struct {
+	common.Sink
+	time  time.Time
+	start time.Time
+}
+
+func (r *runSink) WriteMetric(metric *common.Metric) {
+	if !metric.Time.Before(r.start) {
+		metric.Time = r.time
+	}
+	r.Sink.WriteMetric(metric)
+}
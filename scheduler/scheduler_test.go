@@ -0,0 +1,162 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/b1naryth1ef/yamon/common"
+)
+
+type testSink struct {
+	sync.Mutex
+	metrics []*common.Metric
+}
+
+func (t *testSink) WriteMetric(metric *common.Metric) {
+	t.Lock()
+	defer t.Unlock()
+	t.metrics = append(t.metrics, metric)
+}
+func (t *testSink) WriteLog(entry *common.LogEntry) {}
+func (t *testSink) WriteEvent(event *common.Event)  {}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		timeout  time.Duration
+		splay    time.Duration
+		valid    bool
+	}{
+		{"valid", time.Minute, time.Second, time.Second, true},
+		{"zero interval", 0, 0, 0, false},
+		{"negative interval", -time.Second, 0, 0, false},
+		{"negative timeout", time.Second, -time.Second, 0, false},
+		{"negative splay", time.Second, 0, -time.Second, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New("task", test.interval, test.timeout, test.splay)
+			if (err == nil) != test.valid {
+				t.Fatalf("got error %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		offset   time.Duration
+		now      time.Time
+		next     time.Time
+	}{
+		{"aligned to the minute", time.Minute, 0, base.Add(20 * time.Second), base.Add(time.Minute)},
+		{"exactly on a tick", time.Minute, 0, base, base.Add(time.Minute)},
+		{"aligned to 15s", 15 * time.Second, 0, base.Add(31 * time.Second), base.Add(45 * time.Second)},
+		{"offset later in the interval", time.Minute, 10 * time.Second, base.Add(5 * time.Second), base.Add(10 * time.Second)},
+		{"offset already passed", time.Minute, 10 * time.Second, base.Add(30 * time.Second), base.Add(70 * time.Second)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scheduler := &Scheduler{interval: test.interval, offset: test.offset}
+			if next := scheduler.next(test.now); !next.Equal(test.next) {
+				t.Fatalf("got %v, want %v", next, test.next)
+			}
+		})
+	}
+}
+
+func TestSplayOffset(t *testing.T) {
+	a, err := New("collector:cpu", time.Minute, 0, 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New("collector:cpu", time.Minute, 0, 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.offset != b.offset {
+		t.Fatalf("got offsets %v and %v for the same task, want them stable", a.offset, b.offset)
+	}
+	if a.offset < 0 || a.offset >= 30*time.Second {
+		t.Fatalf("got offset %v outside of the splay", a.offset)
+	}
+
+	// the splay is bounded by the interval
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		scheduler, err := New(name, time.Second, 0, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if scheduler.offset >= time.Second {
+			t.Fatalf("got offset %v for %s, want it below the interval", scheduler.offset, name)
+		}
+	}
+
+	scheduler, err := New("collector:cpu", time.Minute, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scheduler.offset != 0 {
+		t.Fatalf("got offset %v without a splay", scheduler.offset)
+	}
+}
+
+func TestRunSkipsOverruns(t *testing.T) {
+	scheduler, err := New("slow", 20*time.Millisecond, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+
+	runs := 0
+	sink := &testSink{}
+	scheduler.Run(ctx, sink, func(ctx context.Context, sink common.Sink) {
+		runs++
+		<-ctx.Done()
+	})
+
+	if runs != 1 {
+		t.Fatalf("got %d runs, want the first run to block every later tick", runs)
+	}
+	if len(sink.metrics) == 0 {
+		t.Fatal("no skipped runs reported")
+	}
+	for idx, metric := range sink.metrics {
+		if metric.Name != "yamon.scheduler.skipped_runs" || metric.Tags["task"] != "slow" {
+			t.Fatalf("got unexpected metric %+v", metric)
+		}
+		if metric.Value != float64(idx+1) {
+			t.Fatalf("got skipped_runs %v, want %v", metric.Value, idx+1)
+		}
+	}
+}
+
+func TestRunSinkTimestamps(t *testing.T) {
+	tick := time.Now().Truncate(time.Minute)
+	sink := &testSink{}
+	run := &runSink{Sink: sink, time: tick, start: time.Now()}
+
+	run.WriteMetric(common.NewGauge("created", 1, nil))
+
+	earlier := common.NewGauge("earlier", 1, nil)
+	earlier.Time = tick.Add(-time.Hour)
+	run.WriteMetric(earlier)
+
+	if !sink.metrics[0].Time.Equal(tick) {
+		t.Fatalf("got %v for a metric created during the run, want the tick %v", sink.metrics[0].Time, tick)
+	}
+	if !sink.metrics[1].Time.Equal(tick.Add(-time.Hour)) {
+		t.Fatalf("got %v for a metric with an earlier timestamp, want it kept", sink.metrics[1].Time)
+	}
+}
@@ -1,21 +1,26 @@
 package yamon
 
 import (
-	"bufio"
 	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/b1naryth1ef/yamon/common"
+	"github.com/b1naryth1ef/yamon/scheduler"
 )
 
+// lines written to stderr longer than this are dropped
+const scriptMaxStderrLine = 64 * 1024
+
 type ScriptMetric struct {
 	Type  string  `json:"type"`
 	Name  string  `json:"name"`
@@ -27,13 +32,17 @@ type ScriptMetric struct {
 
 func (s *ScriptMetric) Write(sink common.MetricSink) {
 	var entry *common.Metric
-	if s.Type == common.MetricTypeGauge {
+	switch s.Type {
+	case common.MetricTypeGauge:
 		entry = common.NewGauge(s.Name, s.Value, s.Tags)
-	} else if s.Type == common.MetricTypeCounter {
+	case common.MetricTypeCounter:
 		entry = common.NewCounter(s.Name, s.Value, s.Tags)
+	default:
+		slog.Warn("script: dropping metric with invalid type", slog.String("name", s.Name), slog.String("type", s.Type))
+		return
 	}
 	if s.Time > 0 {
-		entry.Time = time.Unix(s.Time, 0)
+		entry.Time = scriptTime(s.Time)
 	}
 	sink.WriteMetric(entry)
 }
@@ -52,7 +61,7 @@ func (l *ScriptLogEntry) Write(sink common.LogSink) {
 
 	entry.Level = l.Level
 	if l.Time > 0 {
-		entry.Time = time.Unix(l.Time, 0)
+		entry.Time = scriptTime(l.Time)
 	}
 
 	sink.WriteLog(entry)
@@ -69,7 +78,7 @@ type ScriptEvent struct {
 func (e *ScriptEvent) Write(sink common.EventSink) {
 	entry := common.NewEvent(e.Type, e.Data, e.Tags)
 	if e.Time > 0 {
-		entry.Time = time.Unix(e.Time, 0)
+		entry.Time = scriptTime(e.Time)
 	}
 	sink.WriteEvent(entry)
 }
@@ -118,12 +127,24 @@ func (s *ScriptResult) Write(sink common.Sink) {
 }
 
 type Script struct {
-	interval  time.Duration
+	schedule  *scheduler.Scheduler
 	path      string
 	args      []string
 	env       []string
 	timeout   time.Duration
 	streaming bool
+	format    string
+
+	credential  *syscall.Credential
+	dir         string
+	cleanEnv    bool
+	memoryLimit int64
+	cpuLimit    float64
+	maxOutput   int64
+
+	cgroupWarned atomic.Bool
+	// last exit code of a nagios plugin, -1 before the first run
+	nagiosStatus int
 }
 
 func NewScript(scriptConfig common.DaemonScriptConfig) (*Script, error) {
@@ -154,87 +175,258 @@ func NewScript(scriptConfig common.DaemonScriptConfig) (*Script, error) {
 		}
 	}
 
-	return &Script{
-		interval:  interval,
+	var splay time.Duration
+	if scriptConfig.Splay != "" {
+		splay, err = time.ParseDuration(scriptConfig.Splay)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Execute applies the timeout itself
+	schedule, err := scheduler.New(scriptConfig.Path, interval, 0, splay)
+	if err != nil {
+		return nil, err
+	}
+
+	script := &Script{
+		schedule:  schedule,
 		path:      scriptConfig.Path,
 		args:      scriptConfig.Args,
 		env:       env,
 		timeout:   timeout,
 		streaming: scriptConfig.Streaming,
-	}, nil
+		dir:       scriptConfig.Dir,
+		cleanEnv:  scriptConfig.CleanEnv,
+		cpuLimit:  scriptConfig.CPULimit,
+		format:    scriptConfig.Format,
+
+		nagiosStatus: -1,
+	}
+
+	if script.format == "" {
+		script.format = scriptFormatJSON
+	}
+	err = validateScriptFormat(script.format, script.streaming)
+	if err != nil {
+		return nil, err
+	}
+
+	if scriptConfig.User != "" || scriptConfig.Group != "" {
+		script.credential, err = lookupCredential(scriptConfig.User, scriptConfig.Group)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if scriptConfig.MemoryLimit != "" {
+		script.memoryLimit, err = parseByteSize(scriptConfig.MemoryLimit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if scriptConfig.MaxOutput != "" {
+		script.maxOutput, err = parseByteSize(scriptConfig.MaxOutput)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return script, nil
 }
 
 var ErrStreamingScriptExited = errors.New("streaming script exited")
 
-func (s *Script) Execute(sink common.Sink) error {
-	var cmd *exec.Cmd
-	var stdout bytes.Buffer
+// lineWriter calls fn for every complete line written to it, lines longer
+// than limit (if set) are dropped
+type lineWriter struct {
+	fn    func(line []byte)
+	buf   []byte
+	limit int64
+	skip  bool
+}
 
-	if s.streaming {
-		cmd = exec.Command(s.path, s.args...)
-		r, w := io.Pipe()
-		cmd.Stdout = w
-
-		go func() {
-			lines := bufio.NewScanner(r)
-			for lines.Scan() {
-				var result ScriptResult
-				line := lines.Bytes()
-
-				err := json.Unmarshal(line, &result)
-				if err != nil {
-					slog.Warn("script: failed to parse streaming result", slog.Any("error", err), slog.String("data", string(line)))
-					continue
-				}
-			}
-		}()
+func (l *lineWriter) Write(data []byte) (int, error) {
+	l.buf = append(l.buf, data...)
+	for {
+		idx := bytes.IndexByte(l.buf, '\n')
+		if idx == -1 {
+			break
+		}
+		if !l.skip {
+			l.fn(l.buf[:idx])
+		}
+		l.skip = false
+		l.buf = l.buf[idx+1:]
+	}
+
+	if l.limit > 0 && int64(len(l.buf)) > l.limit {
+		if !l.skip {
+			slog.Warn("script: dropping line exceeding the output limit", slog.Int64("limit", l.limit))
+		}
+		l.buf = nil
+		l.skip = true
+	}
+	return len(data), nil
+}
+
+// Flush passes any trailing data without a newline to fn
+func (l *lineWriter) Flush() {
+	if len(l.buf) > 0 && !l.skip {
+		l.fn(l.buf)
+		l.buf = nil
+	}
+}
+
+func (s *Script) command(ctx context.Context) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, s.path, s.args...)
+	cmd.Dir = s.dir
+	if s.cleanEnv {
+		cmd.Env = append([]string{cleanEnvPath}, s.env...)
 	} else {
-		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
-		defer cancel()
+		cmd.Env = append(os.Environ(), s.env...)
+	}
 
-		cmd = exec.CommandContext(ctx, s.path, s.args...)
-		cmd.Stdout = &stdout
+	// scripts run in their own process group so that anything they spawn is
+	// killed along with them
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Credential: s.credential}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
 	}
+	cmd.WaitDelay = time.Second * 5
 
-	cmd.Stderr = os.Stderr
-	cmd.Env = append(os.Environ(), s.env...)
+	return cmd
+}
 
-	err := cmd.Run()
+func (s *Script) run(cmd *exec.Cmd) error {
+	cleanup, err := s.start(cmd)
 	if err != nil {
 		return err
 	}
+	defer cleanup()
+
+	return cmd.Wait()
+}
+
+func (s *Script) writeStderr(line []byte, sink common.LogSink) {
+	line = bytes.TrimRight(line, "\r")
+	if len(line) == 0 {
+		return
+	}
+
+	entry := common.NewLogEntry(filepath.Base(s.path), string(line), map[string]string{
+		"script": s.path,
+	})
+	entry.Level = "warning"
+	sink.WriteLog(entry)
+}
+
+func (s *Script) Execute(ctx context.Context, sink common.Sink) error {
+	stderr := &lineWriter{limit: scriptMaxStderrLine, fn: func(line []byte) {
+		s.writeStderr(line, sink)
+	}}
+	defer stderr.Flush()
 
 	if s.streaming {
-		slog.Error("script: exited", slog.String("path", s.path))
-		return ErrStreamingScriptExited
+		return s.stream(ctx, sink, stderr)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	cmd := s.command(ctx)
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderr
+
+	var limit *outputLimitWriter
+	if s.maxOutput > 0 {
+		limit = &outputLimitWriter{limit: s.maxOutput, cancel: cancel, target: &stdout}
+		cmd.Stdout = limit
+	}
+
+	err := s.run(cmd)
+	if limit != nil && limit.written > limit.limit {
+		return errScriptOutputLimit
 	}
 
-	var result ScriptResult
-	err = json.NewDecoder(&stdout).Decode(&result)
+	// nagios plugins report their status through the exit code
+	exitCode := 0
 	if err != nil {
-		return err
+		var exitErr *exec.ExitError
+		if s.format != scriptFormatNagios || !errors.As(err, &exitErr) || exitErr.ExitCode() < 0 || exitErr.ExitCode() >= len(nagiosStates) {
+			return err
+		}
+		exitCode = exitErr.ExitCode()
 	}
-	result.Write(sink)
-	return nil
+
+	return s.writeOutput(stdout.Bytes(), exitCode, sink)
 }
 
-func (s *Script) Run(sink common.Sink) {
-	if s.streaming {
-		go func() {
-			err := s.Execute(sink)
-			if err != nil {
-				slog.Error("script: failed to streaming-execute", slog.String("path", s.path), slog.Any("error", err))
-			}
-		}()
-	} else {
-		ticker := time.NewTicker(s.interval)
-		for {
-			err := s.Execute(sink)
-			if err != nil {
-				slog.Error("script: failed to execute", slog.String("path", s.path), slog.Any("error", err))
-			}
-			time.Sleep(s.interval)
-			<-ticker.C
+// stream runs a streaming script until it exits, writing each line of output
+// as a separate result
+func (s *Script) stream(ctx context.Context, sink common.Sink, stderr io.Writer) error {
+	stdout := &lineWriter{limit: s.maxOutput, fn: func(line []byte) {
+		s.writeStreamingLine(line, sink)
+	}}
+
+	cmd := s.command(ctx)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := s.run(cmd)
+	stdout.Flush()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	} else if err != nil {
+		return fmt.Errorf("%w: %v", ErrStreamingScriptExited, err)
+	}
+	return ErrStreamingScriptExited
+}
+
+// supervise keeps a streaming script running, restarting it with an
+// exponential backoff whenever it exits
+func (s *Script) supervise(ctx context.Context, sink common.Sink) {
+	backoff := time.Second
+
+	for {
+		start := time.Now()
+		err := s.Execute(ctx, sink)
+		if ctx.Err() != nil {
+			return
 		}
+
+		// scripts which ran for a while are restarted quickly again
+		if time.Since(start) > time.Minute {
+			backoff = time.Second
+		}
+
+		slog.Error("script: streaming script exited", slog.String("path", s.path), slog.Any("error", err), slog.String("restart", backoff.String()))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, time.Minute*5)
 	}
 }
+
+// Run executes the script until ctx is cancelled, at which point any running
+// process (and its children) is killed.
+func (s *Script) Run(ctx context.Context, sink common.Sink) {
+	if s.streaming {
+		s.supervise(ctx, sink)
+		return
+	}
+
+	s.schedule.Run(ctx, sink, func(ctx context.Context, sink common.Sink) {
+		err := s.Execute(ctx, sink)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("script: failed to execute", slog.String("path", s.path), slog.Any("error", err))
+		}
+	})
+}
@@ -0,0 +1,391 @@
+package yamon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/b1naryth1ef/yamon/common"
+	"github.com/b1naryth1ef/yamon/prom"
+)
+
+const (
+	scriptFormatJSON       = "json"
+	scriptFormatNDJSON     = "ndjson"
+	scriptFormatPrometheus = "prometheus"
+	scriptFormatInflux     = "influx"
+	scriptFormatNagios     = "nagios"
+)
+
+var errInvalidInfluxLine = errors.New("invalid influx line")
+
+// scriptTime converts a unix timestamp in seconds, milliseconds, microseconds
+// or nanoseconds
+func scriptTime(value int64) time.Time {
+	switch {
+	case value > 1e17:
+		return time.Unix(0, value)
+	case value > 1e14:
+		return time.UnixMicro(value)
+	case value > 1e11:
+		return time.UnixMilli(value)
+	}
+	return time.Unix(value, 0)
+}
+
+func forEachLine(data []byte, fn func(line []byte)) {
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			fn(line)
+		}
+	}
+}
+
+func writeScriptJSONLine(line []byte, sink common.Sink) {
+	var result ScriptResult
+	err := json.Unmarshal(line, &result)
+	if err != nil {
+		slog.Warn("script: failed to parse result", slog.Any("error", err), slog.String("data", string(line)))
+		return
+	}
+	result.Write(sink)
+}
+
+// splitInflux splits on sep outside of double quotes and escapes
+func splitInflux(value string, sep byte) []string {
+	var parts []string
+	quoted := false
+	start := 0
+
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, value[start:])
+}
+
+func unescapeInflux(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+
+	var result strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		result.WriteByte(value[i])
+	}
+	return result.String()
+}
+
+func parseInfluxValue(value string) (float64, bool) {
+	switch value {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true
+	}
+
+	// string fields can't be represented as metrics
+	if strings.HasPrefix(value, "\"") {
+		return 0, false
+	}
+
+	value = strings.TrimRight(value, "iu")
+	v, err := strconv.ParseFloat(value, 64)
+	return v, err == nil
+}
+
+// parseInfluxLine parses "measurement[,tag=value...] field=value[,field=value...] [timestamp]",
+// each field becomes a gauge named <measurement>.<field> (or just the
+// measurement for a field called "value")
+func parseInfluxLine(line string) ([]*common.Metric, error) {
+	parts := splitInflux(line, ' ')
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, errInvalidInfluxLine
+	}
+
+	key := splitInflux(parts[0], ',')
+	measurement := unescapeInflux(key[0])
+	if measurement == "" {
+		return nil, errInvalidInfluxLine
+	}
+
+	tags := map[string]string{}
+	for _, tag := range key[1:] {
+		k, v, ok := strings.Cut(tag, "=")
+		if !ok {
+			return nil, errInvalidInfluxLine
+		}
+		tags[unescapeInflux(k)] = unescapeInflux(v)
+	}
+
+	ts := time.Now()
+	if len(parts) == 3 {
+		v, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			return nil, errInvalidInfluxLine
+		}
+		ts = scriptTime(v)
+	}
+
+	var metrics []*common.Metric
+	for _, field := range splitInflux(parts[1], ',') {
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, errInvalidInfluxLine
+		}
+
+		value, ok := parseInfluxValue(v)
+		if !ok {
+			continue
+		}
+
+		name := measurement
+		if k = unescapeInflux(k); k != "value" {
+			name = measurement + "." + k
+		}
+
+		metric := common.NewGauge(name, value, copyTags(tags))
+		metric.Time = ts
+		metrics = append(metrics, metric)
+	}
+
+	return metrics, nil
+}
+
+func writeInfluxLine(line []byte, sink common.MetricSink) {
+	if line[0] == '#' {
+		return
+	}
+
+	metrics, err := parseInfluxLine(string(line))
+	if err != nil {
+		slog.Warn("script: failed to parse influx line", slog.Any("error", err), slog.String("data", string(line)))
+		return
+	}
+
+	for _, metric := range metrics {
+		sink.WriteMetric(metric)
+	}
+}
+
+var nagiosStates = []string{"ok", "warning", "critical", "unknown"}
+
+type nagiosPerfData struct {
+	Label    string
+	Value    float64
+	Unit     string
+	Warning  *float64
+	Critical *float64
+}
+
+// splitNagiosOutput returns the first line of text and all performance data,
+// which may follow a "|" on the first line or within the long text. Once a
+// "|" is found in the long text all following lines are performance data.
+func splitNagiosOutput(output string) (string, string) {
+	var summary string
+	var perfdata []string
+	inPerfData := false
+
+	for idx, line := range strings.Split(output, "\n") {
+		if inPerfData {
+			perfdata = append(perfdata, line)
+			continue
+		}
+
+		text, perf, ok := strings.Cut(line, "|")
+		if idx == 0 {
+			summary = strings.TrimSpace(text)
+		}
+		if ok {
+			perfdata = append(perfdata, perf)
+			inPerfData = idx > 0
+		}
+	}
+
+	return summary, strings.Join(perfdata, " ")
+}
+
+func parseNagiosThreshold(value string) *float64 {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+// 'label'=value[UOM];[warn];[crit];[min];[max]
+func parseNagiosPerfData(perfdata string) []nagiosPerfData {
+	var result []nagiosPerfData
+
+	for perfdata = strings.TrimSpace(perfdata); perfdata != ""; perfdata = strings.TrimSpace(perfdata) {
+		var label string
+		if perfdata[0] == '\'' {
+			end := strings.Index(perfdata[1:], "'=")
+			if end == -1 {
+				break
+			}
+			label = perfdata[1 : end+1]
+			perfdata = perfdata[end+2:]
+		} else {
+			eq := strings.IndexByte(perfdata, '=')
+			if eq == -1 {
+				break
+			}
+			label = perfdata[:eq]
+			perfdata = perfdata[eq:]
+		}
+		perfdata = strings.TrimPrefix(perfdata, "=")
+
+		var value string
+		value, perfdata, _ = strings.Cut(perfdata, " ")
+
+		fields := strings.Split(value, ";")
+		number := strings.TrimRightFunc(fields[0], func(r rune) bool {
+			return (r < '0' || r > '9') && r != '.'
+		})
+
+		v, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			continue
+		}
+
+		data := nagiosPerfData{
+			Label: label,
+			Value: v,
+			Unit:  fields[0][len(number):],
+		}
+		if len(fields) > 1 {
+			data.Warning = parseNagiosThreshold(fields[1])
+		}
+		if len(fields) > 2 {
+			data.Critical = parseNagiosThreshold(fields[2])
+		}
+		result = append(result, data)
+	}
+
+	return result
+}
+
+type nagiosStatusTransition struct {
+	Check  string `json:"check"`
+	Status string `json:"status"`
+	Output string `json:"output"`
+	// empty for the first run
+	Previous string `json:"previous,omitempty"`
+}
+
+// writeNagios converts the exit status and performance data of a nagios
+// plugin into metrics, emitting an event on the first run and whenever the
+// status changes.
+func (s *Script) writeNagios(output []byte, exitCode int, sink common.Sink) {
+	check := filepath.Base(s.path)
+	summary, perfdata := splitNagiosOutput(string(output))
+
+	state := nagiosStates[exitCode]
+	sink.WriteMetric(common.NewGauge("nagios.status", exitCode, map[string]string{
+		"check": check,
+		"state": state,
+	}))
+
+	for _, data := range parseNagiosPerfData(perfdata) {
+		tags := map[string]string{"check": check, "label": data.Label}
+		if data.Unit != "" {
+			tags["unit"] = data.Unit
+		}
+
+		sink.WriteMetric(common.NewGauge("nagios.perfdata", data.Value, tags))
+		if data.Warning != nil {
+			sink.WriteMetric(common.NewGauge("nagios.perfdata.warning", *data.Warning, copyTags(tags)))
+		}
+		if data.Critical != nil {
+			sink.WriteMetric(common.NewGauge("nagios.perfdata.critical", *data.Critical, copyTags(tags)))
+		}
+	}
+
+	previous := s.nagiosStatus
+	s.nagiosStatus = exitCode
+	if previous != exitCode {
+		transition := nagiosStatusTransition{
+			Check:  check,
+			Status: state,
+			Output: summary,
+		}
+		if previous != -1 {
+			transition.Previous = nagiosStates[previous]
+		}
+		sink.WriteEvent(common.NewEventJSON("nagios.status", transition, map[string]string{"check": check}))
+	}
+}
+
+// writeOutput writes the complete output of a (non streaming) script run
+func (s *Script) writeOutput(output []byte, exitCode int, sink common.Sink) error {
+	switch s.format {
+	case scriptFormatNDJSON:
+		forEachLine(output, func(line []byte) {
+			writeScriptJSONLine(line, sink)
+		})
+	case scriptFormatPrometheus:
+		// unlike the scraper, scripts rarely bother declaring metric types
+		return prom.WriteText(bytes.NewReader(output), prom.TextOptions{Untyped: true, Timestamps: true}, sink)
+	case scriptFormatInflux:
+		forEachLine(output, func(line []byte) {
+			writeInfluxLine(line, sink)
+		})
+	case scriptFormatNagios:
+		s.writeNagios(output, exitCode, sink)
+	default:
+		var result ScriptResult
+		err := json.NewDecoder(bytes.NewReader(output)).Decode(&result)
+		if err != nil {
+			return err
+		}
+		result.Write(sink)
+	}
+	return nil
+}
+
+// writeStreamingLine writes a single line of output from a streaming script
+func (s *Script) writeStreamingLine(line []byte, sink common.Sink) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
+
+	if s.format == scriptFormatInflux {
+		writeInfluxLine(line, sink)
+	} else {
+		writeScriptJSONLine(line, sink)
+	}
+}
+
+func validateScriptFormat(format string, streaming bool) error {
+	switch format {
+	case scriptFormatJSON, scriptFormatNDJSON, scriptFormatInflux:
+		return nil
+	case scriptFormatPrometheus, scriptFormatNagios:
+		if streaming {
+			return fmt.Errorf("format '%s' does not support streaming", format)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format '%s'", format)
+}
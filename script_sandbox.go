@@ -0,0 +1,319 @@
+package yamon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const cgroupMountPath = "/sys/fs/cgroup"
+
+const cleanEnvPath = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+var scriptCgroupCounter atomic.Uint64
+
+// the cgroup under which every limited script run gets its own group, see
+// setupScriptCgroupRoot
+var scriptCgroupRoot = sync.OnceValues(setupScriptCgroupRoot)
+
+// parseByteSize parses sizes such as "512", "64K", "256M" or "1G" (powers of
+// 1024)
+func parseByteSize(input string) (int64, error) {
+	value := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(input)), "B")
+	value = strings.TrimSuffix(value, "I")
+
+	multiplier := int64(1)
+	if len(value) > 0 {
+		switch value[len(value)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier != 1 {
+			value = value[:len(value)-1]
+		}
+	}
+
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid size '%s'", input)
+	}
+	return size * multiplier, nil
+}
+
+func lookupCredential(username, group string) (*syscall.Credential, error) {
+	credential := &syscall.Credential{
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	}
+
+	if username != "" {
+		u, err := user.Lookup(username)
+		if err != nil {
+			u, err = user.LookupId(username)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		uid, _ := strconv.ParseUint(u.Uid, 10, 32)
+		gid, _ := strconv.ParseUint(u.Gid, 10, 32)
+		credential.Uid = uint32(uid)
+		credential.Gid = uint32(gid)
+
+		groups, err := u.GroupIds()
+		if err == nil {
+			for _, id := range groups {
+				if v, err := strconv.ParseUint(id, 10, 32); err == nil {
+					credential.Groups = append(credential.Groups, uint32(v))
+				}
+			}
+		}
+	}
+
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			g, err = user.LookupGroupId(group)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		gid, _ := strconv.ParseUint(g.Gid, 10, 32)
+		credential.Gid = uint32(gid)
+	}
+
+	return credential, nil
+}
+
+// setupScriptCgroupRoot prepares a "scripts" child of the cgroup (v2) the agent
+// was started in, which must be delegated to it (Delegate=yes when run by
+// systemd). cgroups with processes can't enable controllers for their
+// children, so the agent first moves itself into an "agent" child.
+func setupScriptCgroupRoot() (string, error) {
+	// only the unified (v2) hierarchy is supported
+	_, err := os.Stat(filepath.Join(cgroupMountPath, "cgroup.controllers"))
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+
+	var own string
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			own = filepath.Join(cgroupMountPath, path)
+			break
+		}
+	}
+	if own == "" {
+		return "", errors.New("not running in a cgroup v2 hierarchy")
+	}
+
+	// the root cgroup is exempt from the no internal processes rule
+	if own != cgroupMountPath {
+		agent := filepath.Join(own, "agent")
+		err = os.Mkdir(agent, 0755)
+		if err != nil && !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+
+		err = os.WriteFile(filepath.Join(agent, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0)
+		if err != nil {
+			return "", fmt.Errorf("moving agent into %s: %w", agent, err)
+		}
+	}
+
+	err = os.WriteFile(filepath.Join(own, "cgroup.subtree_control"), []byte("+cpu +memory +pids"), 0)
+	if err != nil {
+		return "", err
+	}
+
+	root := filepath.Join(own, "scripts")
+	err = os.Mkdir(root, 0755)
+	if err != nil && !errors.Is(err, os.ErrExist) {
+		return "", err
+	}
+
+	err = os.WriteFile(filepath.Join(root, "cgroup.subtree_control"), []byte("+cpu +memory +pids"), 0)
+	if err != nil {
+		return "", err
+	}
+	return root, nil
+}
+
+// scriptCgroup is a transient cgroup holding a single script run, it allows
+// limiting the cpu and memory of the script and its children and killing all
+// of them at once.
+type scriptCgroup struct {
+	path string
+	fd   *os.File
+}
+
+func newScriptCgroup(memoryLimit int64, cpuLimit float64) (*scriptCgroup, error) {
+	root, err := scriptCgroupRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(root, fmt.Sprintf("run-%d-%d", os.Getpid(), scriptCgroupCounter.Add(1)))
+	err = os.Mkdir(path, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	cgroup := &scriptCgroup{path: path}
+
+	if memoryLimit > 0 {
+		err = os.WriteFile(filepath.Join(path, "memory.max"), []byte(strconv.FormatInt(memoryLimit, 10)), 0)
+		if err == nil {
+			// prefer killing the script over swapping
+			err = os.WriteFile(filepath.Join(path, "memory.swap.max"), []byte("0"), 0)
+			if errors.Is(err, os.ErrNotExist) {
+				err = nil
+			}
+		}
+	}
+
+	if err == nil && cpuLimit > 0 {
+		period := 100000
+		quota := int(cpuLimit * float64(period))
+		err = os.WriteFile(filepath.Join(path, "cpu.max"), []byte(fmt.Sprintf("%d %d", quota, period)), 0)
+	}
+
+	if err == nil {
+		cgroup.fd, err = os.Open(path)
+	}
+
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	return cgroup, nil
+}
+
+func (c *scriptCgroup) Kill() error {
+	err := os.WriteFile(filepath.Join(c.path, "cgroup.kill"), []byte("1"), 0)
+	if err == nil {
+		return nil
+	}
+
+	// cgroup.kill requires linux 5.14
+	data, err := os.ReadFile(filepath.Join(c.path, "cgroup.procs"))
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Fields(string(data)) {
+		if pid, err := strconv.Atoi(line); err == nil {
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+	}
+	return nil
+}
+
+// Close removes the cgroup once all processes within it have exited
+func (c *scriptCgroup) Close() {
+	c.fd.Close()
+
+	for range 10 {
+		err := os.Remove(c.path)
+		if err == nil || errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		c.Kill()
+		time.Sleep(time.Millisecond * 100)
+	}
+	slog.Warn("script: failed to remove cgroup", slog.String("path", c.path))
+}
+
+// outputLimitWriter kills the script once it writes more than limit bytes
+type outputLimitWriter struct {
+	limit   int64
+	written int64
+	cancel  context.CancelFunc
+	target  io.Writer
+}
+
+var errScriptOutputLimit = errors.New("script exceeded its output limit")
+
+func (o *outputLimitWriter) Write(data []byte) (int, error) {
+	o.written += int64(len(data))
+	if o.written > o.limit {
+		o.cancel()
+		return 0, errScriptOutputLimit
+	}
+	return o.target.Write(data)
+}
+
+// limitWithPrlimit wraps cmd in prlimit(1), so that the address space limit is
+// in place before the script is executed
+func limitWithPrlimit(cmd *exec.Cmd, memoryLimit int64) error {
+	path, err := exec.LookPath("prlimit")
+	if err != nil {
+		return err
+	}
+
+	cmd.Args = append([]string{path, fmt.Sprintf("--as=%d", memoryLimit), "--", cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = path
+	return nil
+}
+
+// start runs cmd with the limits of the script applied, when cgroups are not
+// available memory is limited using rlimits instead
+func (s *Script) start(cmd *exec.Cmd) (func(), error) {
+	if s.memoryLimit == 0 && s.cpuLimit == 0 {
+		return func() {}, cmd.Start()
+	}
+
+	cgroup, err := newScriptCgroup(s.memoryLimit, s.cpuLimit)
+	if err != nil {
+		if s.cgroupWarned.CompareAndSwap(false, true) {
+			slog.Warn("script: unable to create cgroup, falling back to rlimits", slog.String("path", s.path), slog.Any("error", err))
+		}
+
+		// there is no rlimit equivalent to a cpu quota
+		if s.memoryLimit > 0 {
+			err = limitWithPrlimit(cmd, s.memoryLimit)
+			if err != nil {
+				slog.Warn("script: unable to apply memory rlimit", slog.String("path", s.path), slog.Any("error", err))
+			}
+		}
+		return func() {}, cmd.Start()
+	}
+
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(cgroup.fd.Fd())
+
+	cancel := cmd.Cancel
+	cmd.Cancel = func() error {
+		cgroup.Kill()
+		return cancel()
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		cgroup.Close()
+		return nil, err
+	}
+	return cgroup.Close, nil
+}
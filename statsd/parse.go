@@ -0,0 +1,81 @@
+package statsd
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errInvalidLine = errors.New("invalid statsd line")
+
+type sampleType string
+
+const (
+	sampleCounter sampleType = "c"
+	sampleGauge   sampleType = "g"
+	sampleTimer   sampleType = "ms"
+	sampleSet     sampleType = "s"
+)
+
+type sample struct {
+	Name string
+	Type sampleType
+	// multiple values may be packed into a single line (dogstatsd)
+	Values []string
+	Rate   float64
+	Tags   map[string]string
+}
+
+// parseLine parses "<name>:<value>[:<value>...]|<type>[|@<rate>][|#<tag>:<value>,...]",
+// unknown dogstatsd extensions (e.g. container ids) are ignored
+func parseLine(line string) (*sample, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return nil, errInvalidLine
+	}
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 || parts[0] == "" {
+		return nil, errInvalidLine
+	}
+
+	s := &sample{
+		Name:   name,
+		Values: strings.Split(parts[0], ":"),
+		Rate:   1,
+		Tags:   map[string]string{},
+	}
+
+	switch parts[1] {
+	case "c":
+		s.Type = sampleCounter
+	case "g":
+		s.Type = sampleGauge
+	case "ms", "h", "d":
+		s.Type = sampleTimer
+	case "s":
+		s.Type = sampleSet
+	default:
+		return nil, errInvalidLine
+	}
+
+	for _, part := range parts[2:] {
+		if strings.HasPrefix(part, "@") {
+			rate, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, errInvalidLine
+			}
+			s.Rate = rate
+		} else if strings.HasPrefix(part, "#") {
+			for _, tag := range strings.Split(part[1:], ",") {
+				if tag == "" {
+					continue
+				}
+				key, value, _ := strings.Cut(tag, ":")
+				s.Tags[key] = value
+			}
+		}
+	}
+
+	return s, nil
+}
@@ -0,0 +1,61 @@
+package statsd
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		sample *sample
+	}{
+		{"hits:1|c", &sample{Name: "hits", Type: sampleCounter, Values: []string{"1"}, Rate: 1}},
+		{"hits:3|c|@0.1", &sample{Name: "hits", Type: sampleCounter, Values: []string{"3"}, Rate: 0.1}},
+		{"queue.depth:42|g", &sample{Name: "queue.depth", Type: sampleGauge, Values: []string{"42"}, Rate: 1}},
+		{"queue.depth:+5|g", &sample{Name: "queue.depth", Type: sampleGauge, Values: []string{"+5"}, Rate: 1}},
+		{"queue.depth:-5|g", &sample{Name: "queue.depth", Type: sampleGauge, Values: []string{"-5"}, Rate: 1}},
+		{"request:320|ms|@0.5", &sample{Name: "request", Type: sampleTimer, Values: []string{"320"}, Rate: 0.5}},
+		{"request:1.5|h", &sample{Name: "request", Type: sampleTimer, Values: []string{"1.5"}, Rate: 1}},
+		{"users:alice|s", &sample{Name: "users", Type: sampleSet, Values: []string{"alice"}, Rate: 1}},
+		{"request:10:20:30|ms", &sample{Name: "request", Type: sampleTimer, Values: []string{"10", "20", "30"}, Rate: 1}},
+		{
+			"hits:1|c|@0.25|#env:prod,region:eu,canary|c:abc123",
+			&sample{Name: "hits", Type: sampleCounter, Values: []string{"1"}, Rate: 0.25, Tags: map[string]string{"env": "prod", "region": "eu", "canary": ""}},
+		},
+
+		{"", nil},
+		{"hits", nil},
+		{":1|c", nil},
+		{"hits:1", nil},
+		{"hits:|c", nil},
+		{"hits:1|x", nil},
+		{"hits:1|c|@0", nil},
+		{"hits:1|c|@2", nil},
+		{"hits:1|c|@fast", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			sample, err := parseLine(test.line)
+			if test.sample == nil {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", sample)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.sample.Tags == nil {
+				test.sample.Tags = map[string]string{}
+			}
+			if sample.Name != test.sample.Name || sample.Type != test.sample.Type || sample.Rate != test.sample.Rate ||
+				!slices.Equal(sample.Values, test.sample.Values) || !maps.Equal(sample.Tags, test.sample.Tags) {
+				t.Fatalf("got %+v, want %+v", sample, test.sample)
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/b1naryth1ef/yamon/common"
+)
+
+var defaultPercentiles = []float64{50, 90, 95, 99}
+
+const (
+	// counters and gauges which have not been observed for this many flushes
+	// are dropped
+	seriesExpiry = 30
+	// new series are ignored once this many exist
+	maxSeries = 10000
+)
+
+type series struct {
+	name string
+	tags map[string]string
+}
+
+type counterSeries struct {
+	series
+	value float64
+	// flushes since the series was last observed
+	idle int
+}
+
+type gaugeSeries struct {
+	series
+	value float64
+	// flushes since the series was last observed
+	idle int
+}
+
+type timerSeries struct {
+	series
+	values []float64
+	// the number of samples, adjusted for sample rates
+	count float64
+}
+
+type setSeries struct {
+	series
+	values map[string]struct{}
+}
+
+// Server receives statsd metrics and aggregates them over a flush interval.
+// Counters are reported as cumulative totals like the rest of yamon, while
+// timer statistics and set cardinality are reported per interval.
+type Server struct {
+	sync.Mutex
+
+	config      *common.DaemonStatsdConfig
+	interval    time.Duration
+	percentiles []float64
+	sink        common.MetricSink
+
+	counters map[string]*counterSeries
+	gauges   map[string]*gaugeSeries
+	timers   map[string]*timerSeries
+	sets     map[string]*setSeries
+
+	limitReported bool
+}
+
+func NewServer(config *common.DaemonStatsdConfig, sink common.MetricSink) (*Server, error) {
+	server := &Server{
+		config:      config,
+		interval:    time.Second * 10,
+		percentiles: config.Percentiles,
+		sink:        sink,
+		counters:    map[string]*counterSeries{},
+		gauges:      map[string]*gaugeSeries{},
+		timers:      map[string]*timerSeries{},
+		sets:        map[string]*setSeries{},
+	}
+
+	if config.FlushInterval != "" {
+		interval, err := time.ParseDuration(config.FlushInterval)
+		if err != nil {
+			return nil, err
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("flush_interval must be positive")
+		}
+		server.interval = interval
+	}
+
+	if server.percentiles == nil {
+		server.percentiles = defaultPercentiles
+	}
+	for _, p := range server.percentiles {
+		if p <= 0 || p > 100 {
+			return nil, fmt.Errorf("invalid percentile %v", p)
+		}
+	}
+
+	return server, nil
+}
+
+// Start binds all configured listeners and begins flushing
+func (s *Server) Start() error {
+	if s.config.UDP != "" {
+		conn, err := net.ListenPacket("udp", s.config.UDP)
+		if err != nil {
+			return err
+		}
+		go s.serve(conn)
+	}
+
+	if s.config.Unixgram != "" {
+		// remove the socket left behind by a previous run, refusing to remove
+		// anything else at that path
+		info, err := os.Lstat(s.config.Unixgram)
+		if err == nil {
+			if info.Mode().Type() != fs.ModeSocket {
+				return fmt.Errorf("%s exists and is not a socket", s.config.Unixgram)
+			}
+			err = os.Remove(s.config.Unixgram)
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		conn, err := net.ListenPacket("unixgram", s.config.Unixgram)
+		if err != nil {
+			return err
+		}
+		go s.serve(conn)
+	}
+
+	go s.run()
+	return nil
+}
+
+func (s *Server) serve(conn net.PacketConn) {
+	buffer := make([]byte, 64*1024)
+	for {
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			slog.Error("statsd: failed to read packet", slog.Any("error", err))
+			time.Sleep(time.Second)
+			continue
+		}
+
+		s.handle(string(buffer[:n]))
+	}
+}
+
+func (s *Server) handle(packet string) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		// dogstatsd events and service checks are not supported
+		if line == "" || strings.HasPrefix(line, "_e{") || strings.HasPrefix(line, "_sc|") {
+			continue
+		}
+
+		sample, err := parseLine(line)
+		if err != nil {
+			slog.Debug("statsd: failed to parse line", slog.String("line", line), slog.Any("error", err))
+			continue
+		}
+
+		s.observe(sample)
+	}
+}
+
+func seriesKey(name string, tags map[string]string) string {
+	parts := make([]string, 0, len(tags))
+	for k, v := range tags {
+		parts = append(parts, k+"="+v)
+	}
+	slices.Sort(parts)
+	return name + "|" + strings.Join(parts, ",")
+}
+
+// admit reports whether a new series may be created, warning once when the
+// limit is reached
+func (s *Server) admit() bool {
+	if len(s.counters)+len(s.gauges)+len(s.timers)+len(s.sets) < maxSeries {
+		return true
+	}
+	if !s.limitReported {
+		slog.Warn("statsd: too many series, ignoring new ones", slog.Int("limit", maxSeries))
+		s.limitReported = true
+	}
+	return false
+}
+
+func (s *Server) observe(sample *sample) {
+	name := s.config.Prefix + sample.Name
+	key := seriesKey(name, sample.Tags)
+	info := series{name: name, tags: sample.Tags}
+
+	for _, value := range sample.Values {
+		if sample.Type == sampleSet {
+			set, ok := s.sets[key]
+			if !ok {
+				if !s.admit() {
+					return
+				}
+				set = &setSeries{series: info, values: map[string]struct{}{}}
+				s.sets[key] = set
+			}
+			set.values[value] = struct{}{}
+			continue
+		}
+
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			slog.Debug("statsd: invalid value", slog.String("name", name), slog.String("value", value))
+			continue
+		}
+
+		switch sample.Type {
+		case sampleCounter:
+			counter, ok := s.counters[key]
+			if !ok {
+				if !s.admit() {
+					return
+				}
+				counter = &counterSeries{series: info}
+				s.counters[key] = counter
+			}
+			counter.value += v / sample.Rate
+			counter.idle = 0
+		case sampleGauge:
+			gauge, ok := s.gauges[key]
+			if !ok {
+				if !s.admit() {
+					return
+				}
+				gauge = &gaugeSeries{series: info}
+				s.gauges[key] = gauge
+			}
+			gauge.idle = 0
+			// a leading sign modifies the current value
+			if value[0] == '+' || value[0] == '-' {
+				gauge.value += v
+			} else {
+				gauge.value = v
+			}
+		case sampleTimer:
+			timer, ok := s.timers[key]
+			if !ok {
+				if !s.admit() {
+					return
+				}
+				timer = &timerSeries{series: info}
+				s.timers[key] = timer
+			}
+			timer.values = append(timer.values, v)
+			timer.count += 1 / sample.Rate
+		}
+	}
+}
+
+func (s *Server) run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.flush()
+	}
+}
+
+func (s *Server) tags(tags map[string]string) map[string]string {
+	result := make(map[string]string, len(tags)+len(s.config.Tags))
+	for k, v := range s.config.Tags {
+		result[k] = v
+	}
+	for k, v := range tags {
+		result[k] = v
+	}
+	return result
+}
+
+func (s *Server) metric(name string, mtype common.MetricType, value float64, tags map[string]string, now time.Time) *common.Metric {
+	metric := common.NewMetric(name, mtype, value, s.tags(tags))
+	metric.Time = now
+	return metric
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(values []float64, p float64) float64 {
+	idx := int(math.Ceil(p/100*float64(len(values)))) - 1
+	return values[max(idx, 0)]
+}
+
+func (s *Server) flush() {
+	now := time.Now()
+
+	// metrics are written once the lock is released to avoid blocking packets
+	var metrics []*common.Metric
+
+	s.Lock()
+	for key, counter := range s.counters {
+		metrics = append(metrics, s.metric(counter.name, common.MetricTypeCounter, counter.value, counter.tags, now))
+		counter.idle += 1
+		if counter.idle >= seriesExpiry {
+			delete(s.counters, key)
+		}
+	}
+
+	for key, gauge := range s.gauges {
+		metrics = append(metrics, s.metric(gauge.name, common.MetricTypeGauge, gauge.value, gauge.tags, now))
+		gauge.idle += 1
+		if gauge.idle >= seriesExpiry {
+			delete(s.gauges, key)
+		}
+	}
+
+	for key, timer := range s.timers {
+		name := timer.name
+		values := timer.values
+		slices.Sort(values)
+
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+
+		metrics = append(metrics,
+			s.metric(name+".count", common.MetricTypeGauge, timer.count, timer.tags, now),
+			s.metric(name+".sum", common.MetricTypeGauge, sum, timer.tags, now),
+			s.metric(name+".mean", common.MetricTypeGauge, sum/float64(len(values)), timer.tags, now),
+			s.metric(name+".min", common.MetricTypeGauge, values[0], timer.tags, now),
+			s.metric(name+".max", common.MetricTypeGauge, values[len(values)-1], timer.tags, now),
+		)
+		for _, p := range s.percentiles {
+			suffix := strings.ReplaceAll(strconv.FormatFloat(p, 'f', -1, 64), ".", "_")
+			metrics = append(metrics, s.metric(name+".p"+suffix, common.MetricTypeGauge, percentile(values, p), timer.tags, now))
+		}
+		delete(s.timers, key)
+	}
+
+	for key, set := range s.sets {
+		metrics = append(metrics, s.metric(set.name, common.MetricTypeGauge, float64(len(set.values)), set.tags, now))
+		delete(s.sets, key)
+	}
+
+	if s.limitReported && len(s.counters)+len(s.gauges) < maxSeries {
+		s.limitReported = false
+	}
+	s.Unlock()
+
+	for _, metric := range metrics {
+		s.sink.WriteMetric(metric)
+	}
+}
@@ -0,0 +1,94 @@
+package statsd
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/b1naryth1ef/yamon/common"
+)
+
+type testSink struct {
+	metrics []*common.Metric
+}
+
+func (t *testSink) WriteMetric(metric *common.Metric) { t.metrics = append(t.metrics, metric) }
+
+func (t *testSink) values() map[string]float64 {
+	result := map[string]float64{}
+	for _, metric := range t.metrics {
+		result[metric.Name] = metric.Value
+	}
+	return result
+}
+
+func newTestServer(t *testing.T) (*Server, *testSink) {
+	t.Helper()
+
+	sink := &testSink{}
+	server, err := NewServer(&common.DaemonStatsdConfig{}, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, sink
+}
+
+func TestServerFlush(t *testing.T) {
+	server, sink := newTestServer(t)
+
+	// a single packet may hold multiple lines
+	server.handle("hits:1|c\nhits:1|c|@0.5\nqueue:10|g\nqueue:-3|g\nrequest:10:30|ms\nusers:a|s\nusers:b|s\nusers:a|s\nbroken\n")
+	server.flush()
+
+	want := map[string]float64{
+		"hits":          3,
+		"queue":         7,
+		"request.count": 2,
+		"request.sum":   40,
+		"request.mean":  20,
+		"request.min":   10,
+		"request.max":   30,
+		"request.p50":   10,
+		"request.p99":   30,
+		"users":         2,
+	}
+	values := sink.values()
+	for name, value := range want {
+		if values[name] != value {
+			t.Errorf("got %s = %v, want %v", name, values[name], value)
+		}
+	}
+
+	// timers and sets are only reported for the interval they were observed in
+	sink.metrics = nil
+	server.flush()
+	values = sink.values()
+	if len(values) != 2 || values["hits"] != 3 || values["queue"] != 7 {
+		t.Fatalf("got %v after an idle flush, want only hits and queue", values)
+	}
+}
+
+func TestServerExpiry(t *testing.T) {
+	server, sink := newTestServer(t)
+
+	server.handle("hits:1|c\nqueue:1|g")
+	for range seriesExpiry {
+		server.flush()
+	}
+
+	sink.metrics = nil
+	server.flush()
+	if len(sink.metrics) != 0 {
+		t.Fatalf("got %d metrics for expired series", len(sink.metrics))
+	}
+}
+
+func TestServerMaxSeries(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	for i := range maxSeries + 10 {
+		server.handle("hits:1|c|#id:" + strconv.Itoa(i))
+	}
+	if len(server.counters) != maxSeries {
+		t.Fatalf("got %d series, want %d", len(server.counters), maxSeries)
+	}
+}
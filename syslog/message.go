@@ -0,0 +1,217 @@
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidMessage = errors.New("invalid syslog message")
+
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// FacilityName returns the conventional name of a syslog facility
+func FacilityName(facility int) string {
+	if facility < 0 || facility >= len(facilityNames) {
+		return strconv.Itoa(facility)
+	}
+	return facilityNames[facility]
+}
+
+type Message struct {
+	HasPriority bool
+	Facility    int
+	Severity    int
+
+	Timestamp time.Time
+	Hostname  string
+	AppName   string
+	ProcID    string
+	MsgID     string
+
+	// RFC5424 structured data flattened to "<sd-id>.<param>" keys
+	StructuredData map[string]string
+
+	Message string
+}
+
+// Parse parses an RFC5424 or RFC3164 formatted message. The priority header is
+// optional so that lines from syslog files (which omit it) can be parsed as
+// well.
+func Parse(data []byte, now time.Time) (*Message, error) {
+	data = bytes.TrimRight(data, "\r\n\x00")
+	msg := &Message{}
+
+	if len(data) > 0 && data[0] == '<' {
+		end := bytes.IndexByte(data, '>')
+		if end < 2 || end > 4 {
+			return nil, ErrInvalidMessage
+		}
+
+		pri, err := strconv.Atoi(string(data[1:end]))
+		if err != nil || pri > 191 {
+			return nil, ErrInvalidMessage
+		}
+		msg.HasPriority = true
+		msg.Facility = pri / 8
+		msg.Severity = pri % 8
+		data = data[end+1:]
+	}
+
+	if len(data) > 2 && data[0] >= '1' && data[0] <= '9' && data[1] == ' ' {
+		return msg, parse5424(data[2:], msg)
+	}
+	return msg, parse3164(data, msg, now)
+}
+
+func nextField(data []byte) (string, []byte) {
+	idx := bytes.IndexByte(data, ' ')
+	if idx == -1 {
+		return string(data), nil
+	}
+	return string(data[:idx]), data[idx+1:]
+}
+
+func nilValue(value string) string {
+	if value == "-" {
+		return ""
+	}
+	return value
+}
+
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func parse5424(data []byte, msg *Message) error {
+	var timestamp string
+	timestamp, data = nextField(data)
+	if timestamp != "-" {
+		ts, err := time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			return fmt.Errorf("%w: bad timestamp %v", ErrInvalidMessage, err)
+		}
+		msg.Timestamp = ts
+	}
+
+	var field string
+	field, data = nextField(data)
+	msg.Hostname = nilValue(field)
+	field, data = nextField(data)
+	msg.AppName = nilValue(field)
+	field, data = nextField(data)
+	msg.ProcID = nilValue(field)
+	field, data = nextField(data)
+	msg.MsgID = nilValue(field)
+
+	if len(data) > 0 && data[0] == '-' {
+		data = data[1:]
+	} else if len(data) > 0 && data[0] == '[' {
+		rest, err := parseStructuredData(data, msg)
+		if err != nil {
+			return err
+		}
+		data = rest
+	}
+
+	data = bytes.TrimPrefix(data, []byte{' '})
+	// UTF-8 BOM
+	data = bytes.TrimPrefix(data, []byte{0xef, 0xbb, 0xbf})
+	msg.Message = string(data)
+	return nil
+}
+
+// [id key="value" key="value"][id2 ...]
+func parseStructuredData(data []byte, msg *Message) ([]byte, error) {
+	msg.StructuredData = map[string]string{}
+
+	for len(data) > 0 && data[0] == '[' {
+		data = data[1:]
+
+		end := bytes.IndexAny(data, " ]")
+		if end == -1 {
+			return nil, fmt.Errorf("%w: unterminated structured data", ErrInvalidMessage)
+		}
+		id := string(data[:end])
+		data = data[end:]
+
+		for len(data) > 0 && data[0] == ' ' {
+			data = data[1:]
+
+			eq := bytes.IndexByte(data, '=')
+			if eq == -1 || eq+1 >= len(data) || data[eq+1] != '"' {
+				return nil, fmt.Errorf("%w: bad structured data param", ErrInvalidMessage)
+			}
+			name := string(data[:eq])
+			data = data[eq+2:]
+
+			var value strings.Builder
+			closed := false
+			for i := 0; i < len(data); i++ {
+				if data[i] == '\\' && i+1 < len(data) {
+					value.WriteByte(data[i+1])
+					i++
+				} else if data[i] == '"' {
+					data = data[i+1:]
+					closed = true
+					break
+				} else {
+					value.WriteByte(data[i])
+				}
+			}
+			if !closed {
+				return nil, fmt.Errorf("%w: unterminated structured data value", ErrInvalidMessage)
+			}
+
+			msg.StructuredData[id+"."+name] = value.String()
+		}
+
+		if len(data) == 0 || data[0] != ']' {
+			return nil, fmt.Errorf("%w: unterminated structured data", ErrInvalidMessage)
+		}
+		data = data[1:]
+	}
+
+	return data, nil
+}
+
+// Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG
+func parse3164(data []byte, msg *Message, now time.Time) error {
+	if len(data) >= 15 {
+		ts, err := time.ParseInLocation(time.Stamp, string(data[:15]), time.Local)
+		if err == nil {
+			// the year is not part of the timestamp, assume the most recent
+			ts = ts.AddDate(now.Year(), 0, 0)
+			if ts.After(now.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+			msg.Timestamp = ts
+			data = bytes.TrimLeft(data[15:], " ")
+
+			// the hostname is frequently omitted by local senders
+			host, rest := nextField(data)
+			if host != "" && !strings.HasSuffix(host, ":") && !strings.Contains(host, "[") && rest != nil {
+				msg.Hostname = host
+				data = rest
+			}
+		}
+	}
+
+	colon := bytes.Index(data, []byte(": "))
+	if colon != -1 && !bytes.ContainsAny(data[:colon], " ") {
+		tag := string(data[:colon])
+		if open := strings.IndexByte(tag, '['); open != -1 && strings.HasSuffix(tag, "]") {
+			msg.ProcID = tag[open+1 : len(tag)-1]
+			tag = tag[:open]
+		}
+		msg.AppName = tag
+		data = data[colon+2:]
+	}
+
+	msg.Message = string(data)
+	return nil
+}
@@ -0,0 +1,161 @@
+package syslog
+
+import (
+	"errors"
+	"maps"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2024, 10, 12, 8, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name    string
+		data    string
+		message *Message
+	}{
+		{
+			"rfc5424 structured data",
+			`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application"][examplePriority@32473 class="high"] An application event log entry`,
+			&Message{
+				HasPriority: true, Facility: 20, Severity: 5,
+				Timestamp: time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+				Hostname:  "mymachine.example.com",
+				AppName:   "evntslog",
+				MsgID:     "ID47",
+				StructuredData: map[string]string{
+					"exampleSDID@32473.iut":         "3",
+					"exampleSDID@32473.eventSource": "Application",
+					"examplePriority@32473.class":   "high",
+				},
+				Message: "An application event log entry",
+			},
+		},
+		{
+			"rfc5424 escaped structured data",
+			`<14>1 2024-10-12T07:59:00+02:00 web01 app 42 - [meta path="C:\\tmp" quote="say \"hi\"" bracket="\]"] done`,
+			&Message{
+				HasPriority: true, Facility: 1, Severity: 6,
+				Timestamp:      time.Date(2024, 10, 12, 7, 59, 0, 0, time.FixedZone("", 2*60*60)),
+				Hostname:       "web01",
+				AppName:        "app",
+				ProcID:         "42",
+				StructuredData: map[string]string{"meta.path": `C:\tmp`, "meta.quote": `say "hi"`, "meta.bracket": "]"},
+				Message:        "done",
+			},
+		},
+		{
+			"rfc5424 nilvalues",
+			"<13>1 - - - - - - hello\n",
+			&Message{HasPriority: true, Facility: 1, Severity: 5, Message: "hello"},
+		},
+		{
+			"rfc5424 without message",
+			"<13>1 - host app - - -",
+			&Message{HasPriority: true, Facility: 1, Severity: 5, Hostname: "host", AppName: "app"},
+		},
+		{
+			"rfc5424 bom",
+			"<13>1 - host app - - - \xef\xbb\xbfutf-8 message",
+			&Message{HasPriority: true, Facility: 1, Severity: 5, Hostname: "host", AppName: "app", Message: "utf-8 message"},
+		},
+		{
+			"rfc3164",
+			`<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed for lonvick on /dev/pts/8`,
+			&Message{
+				HasPriority: true, Facility: 4, Severity: 2,
+				Timestamp: time.Date(2024, 10, 11, 22, 14, 15, 0, time.Local),
+				Hostname:  "mymachine",
+				AppName:   "su",
+				ProcID:    "123",
+				Message:   "'su root' failed for lonvick on /dev/pts/8",
+			},
+		},
+		{
+			"rfc3164 missing hostname",
+			`<13>Oct 11 22:14:15 su: hello`,
+			&Message{
+				HasPriority: true, Facility: 1, Severity: 5,
+				Timestamp: time.Date(2024, 10, 11, 22, 14, 15, 0, time.Local),
+				AppName:   "su",
+				Message:   "hello",
+			},
+		},
+		{
+			"rfc3164 missing hostname with pid",
+			`<13>Oct  1 08:00:00 cron[77]: job started`,
+			&Message{
+				HasPriority: true, Facility: 1, Severity: 5,
+				Timestamp: time.Date(2024, 10, 1, 8, 0, 0, 0, time.Local),
+				AppName:   "cron",
+				ProcID:    "77",
+				Message:   "job started",
+			},
+		},
+		{
+			"rfc3164 previous year",
+			`<13>Dec 31 23:59:59 host app: late`,
+			&Message{
+				HasPriority: true, Facility: 1, Severity: 5,
+				Timestamp: time.Date(2023, 12, 31, 23, 59, 59, 0, time.Local),
+				Hostname:  "host",
+				AppName:   "app",
+				Message:   "late",
+			},
+		},
+		{
+			"file line without priority",
+			`Oct 11 22:14:15 web01 nginx: started`,
+			&Message{
+				Timestamp: time.Date(2024, 10, 11, 22, 14, 15, 0, time.Local),
+				Hostname:  "web01",
+				AppName:   "nginx",
+				Message:   "started",
+			},
+		},
+		{
+			"free text",
+			`<13>something happened`,
+			&Message{HasPriority: true, Facility: 1, Severity: 5, Message: "something happened"},
+		},
+
+		{"pri out of range", `<192>1 - - - - - - hello`, nil},
+		{"pri not a number", `<ab>1 - - - - - - hello`, nil},
+		{"empty pri", `<>hello`, nil},
+		{"unterminated pri", `<13 hello`, nil},
+		{"bad timestamp", `<13>1 yesterday host app - - - hello`, nil},
+		{"unterminated structured data", `<13>1 - host app - - [meta key="value" hello`, nil},
+		{"bad structured data param", `<13>1 - host app - - [meta key=value] hello`, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg, err := Parse([]byte(test.data), now)
+			if test.message == nil {
+				if !errors.Is(err, ErrInvalidMessage) {
+					t.Fatalf("got error %v, want ErrInvalidMessage", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !msg.Timestamp.Equal(test.message.Timestamp) {
+				t.Fatalf("got timestamp %v, want %v", msg.Timestamp, test.message.Timestamp)
+			}
+			if !maps.Equal(msg.StructuredData, test.message.StructuredData) {
+				t.Fatalf("got structured data %v, want %v", msg.StructuredData, test.message.StructuredData)
+			}
+
+			got, want := *msg, *test.message
+			got.Timestamp, want.Timestamp = time.Time{}, time.Time{}
+			got.StructuredData, want.StructuredData = nil, nil
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package syslog
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/b1naryth1ef/yamon/common"
+)
+
+const maxMessageSize = 64 * 1024
+
+const (
+	// connections are closed when no message is received for this long
+	connIdleTimeout = 5 * time.Minute
+	// new connections are refused while this many are open
+	maxConnections = 512
+)
+
+// Server receives syslog messages over UDP, TCP and TLS and writes them as log
+// entries. The hostname of each entry is taken from the message (or the address
+// of the sender) rather than the agent.
+type Server struct {
+	config *common.DaemonSyslogConfig
+	sink   common.LogSink
+	conns  chan struct{}
+}
+
+func NewServer(config *common.DaemonSyslogConfig, sink common.LogSink) *Server {
+	return &Server{config: config, sink: sink, conns: make(chan struct{}, maxConnections)}
+}
+
+// Start binds all configured listeners
+func (s *Server) Start() error {
+	if s.config.UDP != "" {
+		conn, err := net.ListenPacket("udp", s.config.UDP)
+		if err != nil {
+			return err
+		}
+		go s.serveUDP(conn)
+	}
+
+	if s.config.TCP != "" {
+		listener, err := net.Listen("tcp", s.config.TCP)
+		if err != nil {
+			return err
+		}
+		go s.serveStream(listener)
+	}
+
+	if s.config.TLS != nil {
+		tlsConfig, err := loadTLSConfig(s.config.TLS)
+		if err != nil {
+			return err
+		}
+
+		listener, err := tls.Listen("tcp", s.config.TLS.Bind, tlsConfig)
+		if err != nil {
+			return err
+		}
+		go s.serveStream(listener)
+	}
+
+	return nil
+}
+
+func loadTLSConfig(config *common.DaemonSyslogTLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if config.ClientCAFile != "" {
+		data, err := os.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", config.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+func (s *Server) serveUDP(conn net.PacketConn) {
+	buffer := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			slog.Error("syslog: failed to read udp packet", slog.Any("error", err))
+			time.Sleep(time.Second)
+			continue
+		}
+
+		s.handle(buffer[:n], addr)
+	}
+}
+
+func (s *Server) serveStream(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			slog.Error("syslog: failed to accept connection", slog.Any("error", err))
+			time.Sleep(time.Second)
+			continue
+		}
+
+		select {
+		case s.conns <- struct{}{}:
+		default:
+			slog.Warn("syslog: too many connections, refusing", slog.String("remote", conn.RemoteAddr().String()), slog.Int("limit", maxConnections))
+			conn.Close()
+			continue
+		}
+
+		go func() {
+			defer func() { <-s.conns }()
+			s.serveConn(conn)
+		}()
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReaderSize(conn, maxMessageSize)
+	for {
+		err := conn.SetReadDeadline(time.Now().Add(connIdleTimeout))
+		if err != nil {
+			return
+		}
+
+		data, err := readFrame(reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				slog.Warn("syslog: closing connection", slog.String("remote", conn.RemoteAddr().String()), slog.Any("error", err))
+			}
+			return
+		}
+
+		if len(data) > 0 {
+			s.handle(data, conn.RemoteAddr())
+		}
+	}
+}
+
+// readFrame reads a single message using either octet counting ("LEN MSG") or
+// newline delimited framing, as described in RFC6587
+func readFrame(reader *bufio.Reader) ([]byte, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] < '1' || first[0] > '9' {
+		line, err := reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, fmt.Errorf("message exceeds %d bytes", maxMessageSize)
+		} else if err != nil && !(errors.Is(err, io.EOF) && len(line) > 0) {
+			return nil, err
+		}
+		return line, nil
+	}
+
+	prefix, err := reader.ReadString(' ')
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(prefix[:len(prefix)-1])
+	if err != nil || length > maxMessageSize {
+		return nil, fmt.Errorf("invalid frame length '%s'", prefix)
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(reader, data)
+	return data, err
+}
+
+func (s *Server) handle(data []byte, addr net.Addr) {
+	msg, err := Parse(data, time.Now())
+	if err != nil {
+		slog.Debug("syslog: failed to parse message", slog.String("remote", addr.String()), slog.Any("error", err))
+		return
+	}
+
+	s.sink.WriteLog(s.entry(msg, addr))
+}
+
+func (s *Server) entry(msg *Message, addr net.Addr) *common.LogEntry {
+	tags := map[string]string{}
+	for k, v := range s.config.Tags {
+		tags[k] = v
+	}
+	for k, v := range msg.StructuredData {
+		tags[k] = v
+	}
+
+	remote := addr.String()
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	tags["remote_addr"] = remote
+
+	if msg.ProcID != "" {
+		tags["pid"] = msg.ProcID
+	}
+	if msg.MsgID != "" {
+		tags["msgid"] = msg.MsgID
+	}
+
+	service := msg.AppName
+	if service == "" {
+		service = s.config.Service
+	}
+	if service == "" {
+		service = "syslog"
+	}
+
+	entry := common.NewLogEntry(service, msg.Message, tags)
+	if !msg.Timestamp.IsZero() {
+		entry.Time = msg.Timestamp
+	}
+
+	if msg.HasPriority {
+		entry.Level = common.PriorityLevel(strconv.Itoa(msg.Severity))
+		tags["facility"] = FacilityName(msg.Facility)
+	}
+
+	entry.Host = msg.Hostname
+	if entry.Host == "" {
+		entry.Host = remote
+	}
+	entry.Relayed = true
+
+	return entry
+}
@@ -0,0 +1,65 @@
+package syslog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// octets frames a message using octet counting
+func octets(message string) string {
+	return strconv.Itoa(len(message)) + " " + message
+}
+
+func TestReadFrame(t *testing.T) {
+	long := strings.Repeat("x", maxMessageSize)
+
+	tests := []struct {
+		name   string
+		stream string
+		frames []string
+		err    bool
+	}{
+		{"newline delimited", "<13>1 - - - - - - one\n<13>1 - - - - - - two\n", []string{"<13>1 - - - - - - one\n", "<13>1 - - - - - - two\n"}, false},
+		{"newline delimited without trailing newline", "<13>hello", []string{"<13>hello"}, false},
+		{"octet counted", octets("<13>1 - - - - - - one") + octets("<13>1 - - - - - - two"), []string{"<13>1 - - - - - - one", "<13>1 - - - - - - two"}, false},
+		{"octet counted with newlines", octets("<13>multi\nline"), []string{"<13>multi\nline"}, false},
+		{"mixed", "<13>first\n" + octets("<13>second") + "<13>third\n", []string{"<13>first\n", "<13>second", "<13>third\n"}, false},
+		{"truncated octet count", "30 <13>short", nil, true},
+		{"invalid octet count", "1x <13>hello", nil, true},
+		{"octet count too large", strconv.Itoa(maxMessageSize+1) + " <13>hello", nil, true},
+		{"line too long", long + "\n", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := bufio.NewReaderSize(strings.NewReader(test.stream), maxMessageSize)
+
+			var frames []string
+			for {
+				frame, err := readFrame(reader)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					if !test.err {
+						t.Fatal(err)
+					}
+					return
+				}
+				frames = append(frames, string(frame))
+			}
+
+			if test.err {
+				t.Fatalf("expected an error, got frames %q", frames)
+			}
+			if !slices.Equal(frames, test.frames) {
+				t.Fatalf("got frames %q, want %q", frames, test.frames)
+			}
+		})
+	}
+}
@@ -2,16 +2,15 @@ package yamon
 
 import (
 	"encoding/json"
-	"io"
 	"log"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/b1naryth1ef/yamon/common"
 	"github.com/elastic/go-libaudit/v2"
 	"github.com/elastic/go-libaudit/v2/aucoalesce"
 	"github.com/elastic/go-libaudit/v2/auparse"
-	"github.com/influxdata/tail"
 )
 
 type auditHandler struct {
@@ -43,21 +42,10 @@ func (a *auditHandler) EventsLost(count int) {
 	slog.Warn("detected loss of events", slog.Int("count", count))
 }
 
-func RunTail(cfg common.LogFileBlock, sink common.Sink) {
-	t, err := tail.TailFile(cfg.Path, tail.Config{Follow: true, ReOpen: true, Location: &tail.SeekInfo{
-		Offset: 0,
-		Whence: io.SeekEnd,
-	}})
-	if err != nil {
-		log.Panicf("Failed to tail log file %v", err)
-		return
-	}
-
-	level := cfg.Level
-	service := cfg.Service
-	if service == "" {
-		service = cfg.Path
-	}
+// RunTail follows the files matching the log_file path, new files matching a
+// glob are picked up as they are created.
+func RunTail(cfg common.LogFileBlock, positions TailPositionStore, sink common.Sink) {
+	var handler func(path string) (func(string), func())
 
 	if cfg.Format == "audit" {
 		reassembler, err := libaudit.NewReassembler(100, 5*time.Second, &auditHandler{sink: sink})
@@ -76,23 +64,49 @@ func RunTail(cfg common.LogFileBlock, sink common.Sink) {
 			}
 		}()
 
-		for line := range t.Lines {
-			auditMsg, err := auparse.ParseLogLine(line.Text)
+		handler = func(path string) (func(string), func()) {
+			return func(line string) {
+				auditMsg, err := auparse.ParseLogLine(line)
+				if err != nil {
+					slog.Error("auparse ParseLogLine error", slog.Any("error", err))
+					return
+				}
+				reassembler.PushMessage(auditMsg)
+			}, func() {}
+		}
+	} else {
+		format, err := newLogFormat(cfg)
+		if err != nil {
+			log.Panicf("Invalid log format %v: %v", cfg.Format, err)
+		}
+
+		if cfg.Multiline != nil {
+			_, err = newMultilineAggregator(*cfg.Multiline, nil)
 			if err != nil {
-				slog.Error("auparse ParseLogLine error", slog.Any("error", err))
-				continue
+				log.Panicf("Invalid multiline config: %v", err)
 			}
-			reassembler.PushMessage(auditMsg)
 		}
 
-	} else if cfg.Format != "" {
-		log.Panicf("Invalid log format %v", cfg.Format)
-	} else {
-		for line := range t.Lines {
-			logEntry := common.NewLogEntry(service, line.Text, nil)
-			logEntry.Level = level
-			sink.WriteLog(logEntry)
+		// entries from globs are tagged with the file they were read from
+		glob := strings.ContainsAny(cfg.Path, "*?[")
+
+		handler = func(path string) (func(string), func()) {
+			emit := func(text string) {
+				entry := format.Entry(text)
+				if glob {
+					entry.Tags["file"] = path
+				}
+				sink.WriteLog(entry)
+			}
+
+			if cfg.Multiline == nil {
+				return emit, func() {}
+			}
+
+			aggregator, _ := newMultilineAggregator(*cfg.Multiline, emit)
+			return aggregator.Push, aggregator.Flush
 		}
 	}
 
+	newTailInput(cfg.Path, positions, handler).Run()
 }
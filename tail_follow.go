@@ -0,0 +1,448 @@
+package yamon
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	tailPollInterval = 250 * time.Millisecond
+	tailScanInterval = time.Second
+
+	// the number of leading bytes used to fingerprint a file
+	tailFingerprintSize = 256
+)
+
+func fileInode(info fs.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
+
+func isCompressedLog(path string) bool {
+	return strings.HasSuffix(path, ".gz") || strings.HasSuffix(path, ".bz2")
+}
+
+func openCompressedLog(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasSuffix(path, ".bz2") {
+		return struct {
+			io.Reader
+			io.Closer
+		}{bzip2.NewReader(file), file}, nil
+	}
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, file}, nil
+}
+
+// fingerprint identifies a file by (up to) its first tailFingerprintSize bytes,
+// formatted as "<length>:<hash>"
+func fingerprint(data []byte) string {
+	data = data[:min(len(data), tailFingerprintSize)]
+	if len(data) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%d:%x", len(data), sum[:8])
+}
+
+// readFingerprint fingerprints the start of reader, using the same number of
+// bytes as the fingerprint being compared against when one is given
+func readFingerprint(reader io.Reader, compare string) string {
+	size := tailFingerprintSize
+	if compare != "" {
+		fmt.Sscanf(compare, "%d:", &size)
+	}
+
+	data := make([]byte, size)
+	n, _ := io.ReadFull(reader, data)
+	if compare != "" && n != size {
+		return ""
+	}
+	return fingerprint(data[:n])
+}
+
+func trimLine(line string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+}
+
+// readLines passes every line in reader to handle, including a final line
+// without a trailing newline
+func readLines(reader io.Reader, handle func(string)) error {
+	buffered := bufio.NewReader(reader)
+	for {
+		line, err := buffered.ReadString('\n')
+		if line != "" {
+			handle(trimLine(line))
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// fileFollower reads lines from a single file (inode) until the file is
+// rotated or removed, storing its position as it goes.
+type fileFollower struct {
+	path        string
+	inode       uint64
+	fingerprint string
+	positions   TailPositionStore
+	handle      func(string)
+}
+
+func (f *fileFollower) setPosition(file *os.File, offset int64) {
+	// the fingerprint is taken once the file holds enough data to be told apart
+	if len(f.fingerprint) == 0 || offset <= tailFingerprintSize {
+		f.fingerprint = readFingerprint(io.NewSectionReader(file, 0, tailFingerprintSize), "")
+	}
+	f.positions.Set(f.path, TailPosition{Inode: f.inode, Offset: offset, Fingerprint: f.fingerprint})
+}
+
+func (f *fileFollower) run(file *os.File, offset int64) error {
+	_, err := file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(file)
+	var partial string
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err == nil {
+			line = partial + line
+			partial = ""
+
+			offset += int64(len(line))
+			f.handle(trimLine(line))
+			f.setPosition(file, offset)
+			continue
+		} else if err != io.EOF {
+			return err
+		}
+		partial += line
+
+		time.Sleep(tailPollInterval)
+
+		info, err := os.Stat(f.path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		if err != nil || fileInode(info) != f.inode {
+			// the file was rotated or removed, whatever the writer managed to
+			// append before that is still readable from our handle. the file is
+			// then done with, a new file at the same path starts from scratch
+			err = readLines(io.MultiReader(strings.NewReader(partial), reader), f.handle)
+			f.positions.Delete(f.path)
+			return err
+		}
+
+		if info.Size() < offset+int64(len(partial)) {
+			slog.Info("tail: file was truncated, reading from the start", slog.String("path", f.path))
+			_, err = file.Seek(0, io.SeekStart)
+			if err != nil {
+				return err
+			}
+			reader.Reset(file)
+			partial = ""
+			offset = 0
+		}
+	}
+}
+
+// tailInput follows all files matching a log_file path, which may be a glob.
+type tailInput struct {
+	sync.Mutex
+
+	pattern   string
+	positions TailPositionStore
+	// creates the line handler used for a file, returning a function which is
+	// called once the file is no longer followed
+	handler func(path string) (func(string), func())
+
+	// paths with a running follower
+	active map[string]struct{}
+	// inodes which have already been followed, so files that are renamed into
+	// another matching path (e.g. app.log -> app.log.1) are not read twice
+	seen    map[uint64]struct{}
+	matched map[string]struct{}
+}
+
+func newTailInput(pattern string, positions TailPositionStore, handler func(string) (func(string), func())) *tailInput {
+	return &tailInput{
+		pattern:   pattern,
+		positions: positions,
+		handler:   handler,
+		active:    map[string]struct{}{},
+		seen:      map[uint64]struct{}{},
+		matched:   map[string]struct{}{},
+	}
+}
+
+func (t *tailInput) Run() {
+	initial := true
+	warned := false
+
+	for {
+		matches, err := filepath.Glob(t.pattern)
+		if err != nil {
+			slog.Error("tail: invalid path pattern", slog.String("path", t.pattern), slog.Any("error", err))
+			return
+		}
+
+		if len(matches) == 0 && !warned {
+			slog.Warn("tail: no files found, waiting for them to be created", slog.String("path", t.pattern))
+		}
+		warned = len(matches) == 0
+
+		t.scan(matches, initial)
+		initial = false
+
+		time.Sleep(tailScanInterval)
+	}
+}
+
+func (t *tailInput) scan(matches []string, initial bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	inodes := map[uint64]struct{}{}
+	matched := map[string]struct{}{}
+
+	for _, path := range matches {
+		// compressed files are only read when recovering rotated data, they are
+		// otherwise assumed to be copies of files already followed
+		if isCompressedLog(path) {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		inode := fileInode(info)
+		inodes[inode] = struct{}{}
+		matched[path] = struct{}{}
+
+		if _, ok := t.active[path]; ok {
+			continue
+		}
+		if _, ok := t.seen[inode]; ok {
+			continue
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			slog.Warn("tail: failed to open file", slog.String("path", path), slog.Any("error", err))
+			continue
+		}
+
+		// the file may have been replaced between the stat and open
+		info, err = file.Stat()
+		if err != nil {
+			file.Close()
+			continue
+		}
+		inode = fileInode(info)
+
+		t.seen[inode] = struct{}{}
+		t.active[path] = struct{}{}
+		go t.follow(path, file, info, initial)
+	}
+
+	for inode := range t.seen {
+		if _, ok := inodes[inode]; !ok {
+			delete(t.seen, inode)
+		}
+	}
+
+	for path := range t.matched {
+		if _, ok := matched[path]; !ok {
+			if _, ok := t.active[path]; !ok {
+				t.positions.Delete(path)
+			}
+		}
+	}
+	t.matched = matched
+}
+
+func (t *tailInput) follow(path string, file *os.File, info fs.FileInfo, initial bool) {
+	defer func() {
+		t.Lock()
+		delete(t.active, path)
+		t.Unlock()
+	}()
+	defer file.Close()
+
+	handle, done := t.handler(path)
+	defer done()
+
+	follower := &fileFollower{
+		path:      path,
+		inode:     fileInode(info),
+		positions: t.positions,
+		handle:    handle,
+	}
+
+	offset := t.startOffset(follower, info.Size(), initial)
+	slog.Debug("tail: following file", slog.String("path", path), slog.Int64("offset", offset))
+
+	err := follower.run(file, offset)
+	if err != nil {
+		slog.Warn("tail: failed to read file", slog.String("path", path), slog.Any("error", err))
+	}
+}
+
+// startOffset resumes from a stored position when the file is unchanged, files
+// present when yamon starts without a position are read from the end and any
+// other file from the start. A position for another file found when yamon
+// starts means the file was rotated while yamon was not running.
+func (t *tailInput) startOffset(follower *fileFollower, size int64, initial bool) int64 {
+	position, ok := t.positions.Get(follower.path)
+	if ok && position.Inode == follower.inode {
+		follower.fingerprint = position.Fingerprint
+		if position.Offset > size {
+			return 0
+		}
+		return position.Offset
+	} else if ok {
+		if initial {
+			recoverRotated(follower.path, position, follower.handle)
+		}
+		return 0
+	}
+
+	if initial {
+		return size
+	}
+	return 0
+}
+
+// matchesFingerprint checks whether the compressed file at path starts with
+// the data fingerprinted by expected
+func matchesFingerprint(path, expected string) bool {
+	reader, err := openCompressedLog(path)
+	if err != nil {
+		return false
+	}
+	defer reader.Close()
+
+	return readFingerprint(reader, expected) == expected
+}
+
+// recoverRotated reads the remainder of a file which was rotated while yamon
+// was not running, either from the renamed file (found by its inode) or, if it
+// has since been compressed, the compressed sibling with a matching
+// fingerprint.
+func recoverRotated(path string, position TailPosition, handle func(string)) {
+	dir, base := filepath.Split(path)
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return
+	}
+
+	var compressed []string
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == base || !strings.HasPrefix(name, base) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		if isCompressedLog(name) {
+			compressed = append(compressed, filepath.Join(dir, name))
+			continue
+		}
+
+		if fileInode(info) != position.Inode {
+			continue
+		}
+
+		rotated := filepath.Join(dir, name)
+		file, err := os.Open(rotated)
+		if err != nil {
+			slog.Warn("tail: failed to open rotated file", slog.String("path", rotated), slog.Any("error", err))
+			return
+		}
+		defer file.Close()
+
+		slog.Info("tail: reading remainder of rotated file", slog.String("path", rotated))
+		_, err = file.Seek(position.Offset, io.SeekStart)
+		if err == nil {
+			err = readLines(file, handle)
+		}
+		if err != nil {
+			slog.Warn("tail: failed to read rotated file", slog.String("path", rotated), slog.Any("error", err))
+		}
+		return
+	}
+
+	// positions stored by older versions can't be matched
+	if position.Fingerprint == "" {
+		return
+	}
+
+	var match string
+	for _, candidate := range compressed {
+		if matchesFingerprint(candidate, position.Fingerprint) {
+			match = candidate
+			break
+		}
+	}
+	if match == "" {
+		slog.Warn("tail: rotated file not found, its remainder is lost", slog.String("path", path))
+		return
+	}
+
+	reader, err := openCompressedLog(match)
+	if err != nil {
+		slog.Warn("tail: failed to open compressed file", slog.String("path", match), slog.Any("error", err))
+		return
+	}
+	defer reader.Close()
+
+	slog.Info("tail: reading remainder of compressed rotated file", slog.String("path", match))
+	_, err = io.CopyN(io.Discard, reader, position.Offset)
+	if err == nil {
+		err = readLines(reader, handle)
+	}
+	if err != nil {
+		slog.Warn("tail: failed to read compressed file", slog.String("path", match), slog.Any("error", err))
+	}
+}
@@ -0,0 +1,152 @@
+package yamon
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+type collectedLines struct {
+	sync.Mutex
+	lines []string
+}
+
+func (c *collectedLines) handler(path string) (func(string), func()) {
+	return func(line string) {
+		c.Lock()
+		c.lines = append(c.lines, line)
+		c.Unlock()
+	}, func() {}
+}
+
+func (c *collectedLines) get() []string {
+	c.Lock()
+	defer c.Unlock()
+	return slices.Clone(c.lines)
+}
+
+// scanUntil scans for files until want has been collected, then keeps going
+// for a little longer to catch any duplicated lines
+func scanUntil(t *testing.T, input *tailInput, lines *collectedLines, initial bool, want []string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(lines.get()) < len(want) && time.Now().Before(deadline) {
+		matches, _ := filepath.Glob(input.pattern)
+		input.scan(matches, initial)
+		initial = false
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	for range 10 {
+		matches, _ := filepath.Glob(input.pattern)
+		input.scan(matches, false)
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if got := lines.get(); !slices.Equal(got, want) {
+		t.Fatalf("got lines %q, want %q", got, want)
+	}
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeGzip(t *testing.T, path, data string) {
+	t.Helper()
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	writer := gzip.NewWriter(file)
+	writer.Write([]byte(data))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTailFollowsRotatedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	positions, err := NewFileBasedTailPositionStore(filepath.Join(dir, "positions.json"), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appendFile(t, path, "a\n")
+	lines := &collectedLines{}
+	input := newTailInput(path, positions, lines.handler)
+	scanUntil(t, input, lines, false, []string{"a"})
+
+	appendFile(t, path, "b\n")
+	err = os.Rename(path, path+".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the writer still has the old file open
+	appendFile(t, path+".1", "c\n")
+	appendFile(t, path, "d\n")
+
+	scanUntil(t, input, lines, false, []string{"a", "b", "c", "d"})
+
+	position, ok := positions.Get(path)
+	info, _ := os.Stat(path)
+	if !ok || position.Inode != fileInode(info) || position.Offset != 2 {
+		t.Fatalf("unexpected position %+v after rotation", position)
+	}
+}
+
+func TestTailRecoversCompressedRotatedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	positions, err := NewFileBasedTailPositionStore(filepath.Join(dir, "positions.json"), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// yamon read the first line of the file before it was stopped
+	content := "first\nsecond\n"
+	appendFile(t, path, content)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	positions.Set(path, TailPosition{
+		Inode:       fileInode(info),
+		Offset:      int64(len("first\n")),
+		Fingerprint: fingerprint([]byte(content)),
+	})
+
+	// while it was stopped the file was rotated and compressed twice, so the
+	// most recent compressed file isn't the one that was being read
+	os.Remove(path)
+	writeGzip(t, path+".2.gz", content+"third\n")
+	writeGzip(t, path+".1.gz", "other\n")
+	appendFile(t, path, "new\n")
+
+	lines := &collectedLines{}
+	input := newTailInput(path, positions, lines.handler)
+	scanUntil(t, input, lines, true, []string{"second", "third", "new"})
+}
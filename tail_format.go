@@ -0,0 +1,392 @@
+package yamon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/b1naryth1ef/yamon/common"
+	"github.com/b1naryth1ef/yamon/syslog"
+)
+
+type logLineParser func(line string) (map[string]string, error)
+
+var errLogLineNoMatch = errors.New("line did not match pattern")
+
+var (
+	defaultLevelFields   = []string{"level", "lvl", "severity"}
+	defaultTimeFields    = []string{"time", "ts", "timestamp", "@timestamp"}
+	defaultServiceFields = []string{"service"}
+	defaultMessageFields = []string{"message", "msg"}
+)
+
+func flattenJSON(prefix string, value any, fields map[string]string) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, inner := range v {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flattenJSON(key, inner, fields)
+		}
+	case string:
+		fields[prefix] = v
+	case json.Number:
+		fields[prefix] = v.String()
+	case bool:
+		fields[prefix] = strconv.FormatBool(v)
+	case nil:
+		fields[prefix] = ""
+	default:
+		data, _ := json.Marshal(v)
+		fields[prefix] = string(data)
+	}
+}
+
+func parseJSONLine(line string) (map[string]string, error) {
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+
+	var data map[string]any
+	err := decoder.Decode(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]string{}
+	flattenJSON("", data, fields)
+	return fields, nil
+}
+
+// key=value key="quoted \"value\"" flag
+func parseLogfmtLine(line string) (map[string]string, error) {
+	fields := map[string]string{}
+
+	for i := 0; i < len(line); {
+		if line[i] == ' ' {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' {
+			i++
+		}
+		key := line[start:i]
+
+		if i >= len(line) || line[i] == ' ' {
+			fields[key] = "true"
+			continue
+		}
+		i++
+
+		if i < len(line) && line[i] == '"' {
+			var value strings.Builder
+			i++
+			for i < len(line) && line[i] != '"' {
+				if line[i] == '\\' && i+1 < len(line) {
+					i++
+				}
+				value.WriteByte(line[i])
+				i++
+			}
+			i++
+			fields[key] = value.String()
+		} else {
+			start = i
+			for i < len(line) && line[i] != ' ' {
+				i++
+			}
+			fields[key] = line[start:i]
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil, errLogLineNoMatch
+	}
+	return fields, nil
+}
+
+func newRegexParser(pattern string) (logLineParser, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	names := re.SubexpNames()
+	return func(line string) (map[string]string, error) {
+		match := re.FindStringSubmatch(line)
+		if match == nil {
+			return nil, errLogLineNoMatch
+		}
+
+		fields := map[string]string{}
+		for idx, name := range names {
+			if name != "" && match[idx] != "" {
+				fields[name] = match[idx]
+			}
+		}
+		return fields, nil
+	}, nil
+}
+
+func syslogFields(msg *syslog.Message) map[string]string {
+	fields := map[string]string{}
+	for key, value := range msg.StructuredData {
+		fields[key] = value
+	}
+
+	if msg.HasPriority {
+		fields["level"] = common.PriorityLevel(strconv.Itoa(msg.Severity))
+		fields["facility"] = syslog.FacilityName(msg.Facility)
+	}
+	if !msg.Timestamp.IsZero() {
+		fields["time"] = msg.Timestamp.Format(time.RFC3339Nano)
+	}
+	if msg.Hostname != "" {
+		fields["hostname"] = msg.Hostname
+	}
+	if msg.AppName != "" {
+		fields["service"] = msg.AppName
+	}
+	if msg.ProcID != "" {
+		fields["pid"] = msg.ProcID
+	}
+	if msg.MsgID != "" {
+		fields["msgid"] = msg.MsgID
+	}
+	fields["message"] = msg.Message
+	return fields
+}
+
+func parseSyslogLine(line string) (map[string]string, error) {
+	msg, err := syslog.Parse([]byte(line), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return syslogFields(msg), nil
+}
+
+// shared by nginx and apache
+var combinedLogRe = regexp.MustCompile(
+	`^(?P<remote_addr>\S+) \S+ (?P<remote_user>\S+) \[(?P<time>[^\]]+)\] "(?P<request>[^"]*)" (?P<status>\d{3}) (?P<body_bytes_sent>\d+|-)(?: "(?P<http_referer>[^"]*)" "(?P<http_user_agent>[^"]*)")?`,
+)
+
+func parseCombinedLine(line string) (map[string]string, error) {
+	match := combinedLogRe.FindStringSubmatch(line)
+	if match == nil {
+		return nil, errLogLineNoMatch
+	}
+
+	fields := map[string]string{}
+	for idx, name := range combinedLogRe.SubexpNames() {
+		if name != "" && match[idx] != "" && match[idx] != "-" {
+			fields[name] = match[idx]
+		}
+	}
+
+	if ts, err := time.Parse("02/Jan/2006:15:04:05 -0700", fields["time"]); err == nil {
+		fields["time"] = ts.Format(time.RFC3339Nano)
+	}
+
+	if parts := strings.SplitN(fields["request"], " ", 3); len(parts) == 3 {
+		fields["method"] = parts[0]
+		fields["path"] = parts[1]
+		fields["protocol"] = parts[2]
+		delete(fields, "request")
+	}
+
+	return fields, nil
+}
+
+func normalizeLevel(level string) string {
+	switch strings.ToLower(level) {
+	case "emerg", "emergency", "alert", "crit", "critical", "fatal", "panic":
+		return "critical"
+	case "err", "error":
+		return "error"
+	case "warn", "warning":
+		return "warning"
+	case "notice", "info", "information", "informational":
+		return "info"
+	case "debug", "trace", "dbg":
+		return "debug"
+	}
+	return strings.ToLower(level)
+}
+
+// parseLogTime parses RFC3339 or unix timestamps (in s, ms, us or ns) unless
+// an explicit layout is provided
+func parseLogTime(value, layout string) (time.Time, bool) {
+	if layout != "" {
+		ts, err := time.Parse(layout, value)
+		return ts, err == nil
+	}
+
+	if ts, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return ts, true
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || v <= 0 {
+		return time.Time{}, false
+	}
+
+	switch {
+	case v > 1e17:
+		return time.Unix(0, int64(v)), true
+	case v > 1e14:
+		return time.UnixMicro(int64(v)), true
+	case v > 1e11:
+		return time.UnixMilli(int64(v)), true
+	}
+	sec, frac := math.Modf(v)
+	return time.Unix(int64(sec), int64(frac*1e9)), true
+}
+
+func fieldNames(configured string, defaults []string) []string {
+	if configured != "" {
+		return []string{configured}
+	}
+	return defaults
+}
+
+// takeField removes and returns the first field present out of names
+func takeField(fields map[string]string, names []string) (string, bool) {
+	for _, name := range names {
+		if value, ok := fields[name]; ok {
+			delete(fields, name)
+			return value, true
+		}
+	}
+	return "", false
+}
+
+type logFormat struct {
+	parse   logLineParser
+	service string
+	level   string
+
+	timeFormat    string
+	levelFields   []string
+	timeFields    []string
+	serviceFields []string
+	messageFields []string
+	tagFields     map[string]struct{}
+}
+
+func newLogFormat(cfg common.LogFileBlock) (*logFormat, error) {
+	format := &logFormat{
+		service:       cfg.Service,
+		level:         cfg.Level,
+		timeFormat:    cfg.TimeFormat,
+		levelFields:   fieldNames(cfg.LevelField, defaultLevelFields),
+		timeFields:    fieldNames(cfg.TimeField, defaultTimeFields),
+		serviceFields: fieldNames(cfg.ServiceField, defaultServiceFields),
+		messageFields: fieldNames(cfg.MessageField, defaultMessageFields),
+	}
+	if format.service == "" {
+		format.service = cfg.Path
+	}
+
+	format.tagFields = map[string]struct{}{}
+	for _, field := range cfg.TagFields {
+		format.tagFields[field] = struct{}{}
+	}
+
+	switch cfg.Format {
+	case "":
+	case "json":
+		format.parse = parseJSONLine
+	case "logfmt":
+		format.parse = parseLogfmtLine
+	case "regex":
+		if cfg.Pattern == "" {
+			return nil, fmt.Errorf("regex format requires a pattern")
+		}
+		parse, err := newRegexParser(cfg.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		format.parse = parse
+	case "syslog":
+		format.parse = parseSyslogLine
+	case "nginx_combined", "apache_combined":
+		format.parse = parseCombinedLine
+	default:
+		return nil, fmt.Errorf("unknown format '%s'", cfg.Format)
+	}
+
+	return format, nil
+}
+
+func (f *logFormat) Entry(line string) *common.LogEntry {
+	entry := common.NewLogEntry(f.service, line, nil)
+	entry.Level = f.level
+
+	if f.parse == nil {
+		return entry
+	}
+
+	fields, err := f.parse(line)
+	if err != nil {
+		slog.Debug("tail: failed to parse log line", slog.String("service", f.service), slog.Any("error", err))
+		return entry
+	}
+
+	if value, ok := takeField(fields, f.levelFields); ok && value != "" {
+		entry.Level = normalizeLevel(value)
+	}
+	if value, ok := takeField(fields, f.timeFields); ok {
+		if ts, ok := parseLogTime(value, f.timeFormat); ok {
+			entry.Time = ts
+		}
+	}
+	if value, ok := takeField(fields, f.serviceFields); ok && value != "" {
+		entry.Service = value
+	}
+	message, hasMessage := takeField(fields, f.messageFields)
+
+	for key := range f.tagFields {
+		if value, ok := fields[key]; ok {
+			entry.Tags[key] = value
+			delete(fields, key)
+		}
+	}
+
+	// without a message field the line itself already holds the other fields
+	if hasMessage {
+		entry.Data = appendLogfmt(message, fields)
+	}
+
+	return entry
+}
+
+// appendLogfmt appends the fields in logfmt (sorted by key) to message
+func appendLogfmt(message string, fields map[string]string) string {
+	var result strings.Builder
+	result.WriteString(message)
+
+	for _, key := range slices.Sorted(maps.Keys(fields)) {
+		if result.Len() > 0 {
+			result.WriteByte(' ')
+		}
+
+		value := fields[key]
+		result.WriteString(key)
+		result.WriteByte('=')
+		if value == "" || strings.ContainsAny(value, " =\"\\\t\n") {
+			value = strconv.Quote(value)
+		}
+		result.WriteString(value)
+	}
+	return result.String()
+}
@@ -0,0 +1,257 @@
+package yamon
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/b1naryth1ef/yamon/common"
+)
+
+type logLineTest struct {
+	name   string
+	line   string
+	fields map[string]string
+}
+
+func runLogLineTests(t *testing.T, parse logLineParser, tests []logLineTest) {
+	t.Helper()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fields, err := parse(test.line)
+			if test.fields == nil {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", fields)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(fields, test.fields) {
+				t.Fatalf("got %v, want %v", fields, test.fields)
+			}
+		})
+	}
+}
+
+func TestParseJSONLine(t *testing.T) {
+	runLogLineTests(t, parseJSONLine, []logLineTest{
+		{"flat", `{"level":"info","msg":"started","port":8080}`, map[string]string{"level": "info", "msg": "started", "port": "8080"}},
+		{"nested", `{"http":{"method":"GET","status":200},"ok":true}`, map[string]string{"http.method": "GET", "http.status": "200", "ok": "true"}},
+		{"large number", `{"id":12345678901234567890}`, map[string]string{"id": "12345678901234567890"}},
+		{"null and array", `{"user":null,"tags":["a","b"]}`, map[string]string{"user": "", "tags": `["a","b"]`}},
+		{"invalid", `level=info msg=started`, nil},
+		{"not an object", `["a"]`, nil},
+	})
+}
+
+func TestParseLogfmtLine(t *testing.T) {
+	runLogLineTests(t, parseLogfmtLine, []logLineTest{
+		{"plain", `level=info msg=started port=8080`, map[string]string{"level": "info", "msg": "started", "port": "8080"}},
+		{"quoted", `msg="request \"done\"" path=/`, map[string]string{"msg": `request "done"`, "path": "/"}},
+		{"flag", `debug level=warn  cached`, map[string]string{"debug": "true", "level": "warn", "cached": "true"}},
+		{"empty value", `user= level=info`, map[string]string{"user": "", "level": "info"}},
+		{"empty", `   `, nil},
+	})
+}
+
+func TestParseCombinedLine(t *testing.T) {
+	runLogLineTests(t, parseCombinedLine, []logLineTest{
+		{
+			"combined",
+			`203.0.113.9 - alice [10/Oct/2024:13:55:36 -0700] "GET /index.html HTTP/1.1" 200 2326 "https://example.com/" "curl/8.5.0"`,
+			map[string]string{
+				"remote_addr":     "203.0.113.9",
+				"remote_user":     "alice",
+				"time":            "2024-10-10T13:55:36-07:00",
+				"method":          "GET",
+				"path":            "/index.html",
+				"protocol":        "HTTP/1.1",
+				"status":          "200",
+				"body_bytes_sent": "2326",
+				"http_referer":    "https://example.com/",
+				"http_user_agent": "curl/8.5.0",
+			},
+		},
+		{
+			"common without referer",
+			`198.51.100.4 - - [10/Oct/2024:13:55:36 +0000] "POST /api HTTP/2.0" 500 -`,
+			map[string]string{
+				"remote_addr": "198.51.100.4",
+				"time":        "2024-10-10T13:55:36Z",
+				"method":      "POST",
+				"path":        "/api",
+				"protocol":    "HTTP/2.0",
+				"status":      "500",
+			},
+		},
+		{
+			"malformed request",
+			`198.51.100.4 - - [10/Oct/2024:13:55:36 +0000] "-" 400 0 "-" "-"`,
+			map[string]string{
+				"remote_addr":     "198.51.100.4",
+				"time":            "2024-10-10T13:55:36Z",
+				"status":          "400",
+				"body_bytes_sent": "0",
+			},
+		},
+		{"not an access log", `something went wrong`, nil},
+	})
+}
+
+func TestRegexParser(t *testing.T) {
+	parse, err := newRegexParser(`^(?P<time>\S+) \[(?P<level>\w+)\] (?P<message>.*?)(?: id=(?P<id>\d+))?$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runLogLineTests(t, parse, []logLineTest{
+		{"all groups", `2024-10-10T13:55:36Z [WARN] disk almost full id=7`, map[string]string{"time": "2024-10-10T13:55:36Z", "level": "WARN", "message": "disk almost full", "id": "7"}},
+		{"optional group", `2024-10-10T13:55:36Z [INFO] ready`, map[string]string{"time": "2024-10-10T13:55:36Z", "level": "INFO", "message": "ready"}},
+		{"no match", `ready`, nil},
+	})
+}
+
+func TestParseLogTime(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		layout string
+		time   time.Time
+		ok     bool
+	}{
+		{"rfc3339", "2024-10-10T13:55:36.5Z", "", time.Date(2024, 10, 10, 13, 55, 36, 500000000, time.UTC), true},
+		{"seconds", "1728568536", "", time.Unix(1728568536, 0), true},
+		{"fractional seconds", "1728568536.25", "", time.Unix(1728568536, 250000000), true},
+		{"milliseconds", "1728568536123", "", time.UnixMilli(1728568536123), true},
+		{"microseconds", "1728568536123456", "", time.UnixMicro(1728568536123456), true},
+		{"nanoseconds", "1728568536123456789", "", time.Unix(1728568536, 123456768), true},
+		{"layout", "10/10/2024 13:55", "01/02/2006 15:04", time.Date(2024, 10, 10, 13, 55, 0, 0, time.UTC), true},
+		{"layout mismatch", "2024-10-10T13:55:36Z", "01/02/2006 15:04", time.Time{}, false},
+		{"zero", "0", "", time.Time{}, false},
+		{"garbage", "yesterday", "", time.Time{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ts, ok := parseLogTime(test.value, test.layout)
+			if ok != test.ok {
+				t.Fatalf("got ok %v, want %v", ok, test.ok)
+			}
+			// nanosecond timestamps pass through a float64 and lose precision
+			if ok && ts.Sub(test.time).Abs() > time.Microsecond {
+				t.Fatalf("got %v, want %v", ts, test.time)
+			}
+		})
+	}
+}
+
+func TestLogFormatEntry(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  common.LogFileBlock
+		line    string
+		service string
+		level   string
+		data    string
+		tags    map[string]string
+	}{
+		{
+			"raw",
+			common.LogFileBlock{Path: "/var/log/app.log", Level: "info"},
+			"hello",
+			"/var/log/app.log", "info", "hello", map[string]string{},
+		},
+		{
+			"json",
+			common.LogFileBlock{Path: "/var/log/app.log", Format: "json", TagFields: []string{"method"}},
+			`{"level":"ERR","msg":"request failed","service":"api","method":"GET","status":500}`,
+			"api", "error", "request failed status=500", map[string]string{"method": "GET"},
+		},
+		{
+			"logfmt without message",
+			common.LogFileBlock{Path: "/var/log/app.log", Service: "worker", Format: "logfmt"},
+			`level=warning job=cleanup`,
+			"worker", "warning", "level=warning job=cleanup", map[string]string{},
+		},
+		{
+			"syslog",
+			common.LogFileBlock{Path: "/var/log/syslog", Format: "syslog"},
+			`<11>1 2024-10-10T13:55:36Z web01 nginx 812 - - worker exited`,
+			"nginx", "error", "worker exited facility=user hostname=web01 pid=812", map[string]string{},
+		},
+		{
+			"unparsable line",
+			common.LogFileBlock{Path: "/var/log/app.log", Format: "json", Level: "info"},
+			`not json`,
+			"/var/log/app.log", "info", "not json", map[string]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			format, err := newLogFormat(test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entry := format.Entry(test.line)
+			if entry.Service != test.service || entry.Level != test.level || entry.Data != test.data {
+				t.Fatalf("got service %q, level %q, data %q, want %q, %q, %q", entry.Service, entry.Level, entry.Data, test.service, test.level, test.data)
+			}
+			if !maps.Equal(entry.Tags, test.tags) {
+				t.Fatalf("got tags %v, want %v", entry.Tags, test.tags)
+			}
+		})
+	}
+}
+
+func TestLogFileFormatValidation(t *testing.T) {
+	// every format accepted by the config is handled by the tailer, audit logs
+	// are reassembled instead of being parsed line by line
+	for _, format := range common.LogFileFormats {
+		if format == "audit" {
+			continue
+		}
+		_, err := newLogFormat(common.LogFileBlock{Path: "/var/log/app.log", Format: format, Pattern: "(?P<message>.*)"})
+		if err != nil {
+			t.Fatalf("format '%s': %v", format, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"valid", `log_file "/var/log/app.log" { format = "json" }`, ""},
+		{"unknown format", `log_file "/var/log/app.log" { format = "jsonl" }`, "unknown format 'jsonl'"},
+		{"regex without pattern", `log_file "/var/log/app.log" { format = "regex" }`, "requires a pattern"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "yamon.hcl")
+			err := os.WriteFile(path, []byte("target = \"http://localhost:8080\"\n"+test.config+"\n"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = common.LoadDaemonConfig(path)
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package yamon
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/b1naryth1ef/yamon/common"
+)
+
+type multilineAggregator struct {
+	sync.Mutex
+
+	start        *regexp.Regexp
+	continuation *regexp.Regexp
+	maxLines     int
+	maxBytes     int
+	timeout      time.Duration
+	timer        *time.Timer
+	emit         func(string)
+
+	buffer []string
+	size   int
+}
+
+func newMultilineAggregator(cfg common.LogFileMultilineBlock, emit func(string)) (*multilineAggregator, error) {
+	aggregator := &multilineAggregator{
+		maxLines: cfg.MaxLines,
+		maxBytes: cfg.MaxBytes,
+		timeout:  time.Second,
+		emit:     emit,
+	}
+
+	if (cfg.StartPattern == "") == (cfg.ContinuationPattern == "") {
+		return nil, fmt.Errorf("multiline requires exactly one of start_pattern or continuation_pattern")
+	}
+
+	var err error
+	if cfg.StartPattern != "" {
+		aggregator.start, err = regexp.Compile(cfg.StartPattern)
+	} else {
+		aggregator.continuation, err = regexp.Compile(cfg.ContinuationPattern)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if aggregator.maxLines <= 0 {
+		aggregator.maxLines = 500
+	}
+	if aggregator.maxBytes <= 0 {
+		aggregator.maxBytes = 64 * 1024
+	}
+
+	if cfg.FlushTimeout != "" {
+		aggregator.timeout, err = time.ParseDuration(cfg.FlushTimeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	aggregator.timer = time.AfterFunc(aggregator.timeout, aggregator.Flush)
+	aggregator.timer.Stop()
+
+	return aggregator, nil
+}
+
+func (m *multilineAggregator) isContinuation(line string) bool {
+	if m.start != nil {
+		return !m.start.MatchString(line)
+	}
+	return m.continuation.MatchString(line)
+}
+
+func (m *multilineAggregator) flush() {
+	if len(m.buffer) == 0 {
+		return
+	}
+
+	m.emit(strings.Join(m.buffer, "\n"))
+	m.buffer = m.buffer[:0]
+	m.size = 0
+}
+
+// Flush emits any buffered lines as a single entry
+func (m *multilineAggregator) Flush() {
+	m.Lock()
+	defer m.Unlock()
+	m.flush()
+}
+
+func (m *multilineAggregator) Push(line string) {
+	m.Lock()
+	defer m.Unlock()
+
+	if !m.isContinuation(line) {
+		m.flush()
+	}
+
+	m.buffer = append(m.buffer, line)
+	m.size += len(line)
+
+	if len(m.buffer) >= m.maxLines || m.size >= m.maxBytes {
+		m.flush()
+		m.timer.Stop()
+		return
+	}
+
+	m.timer.Reset(m.timeout)
+}
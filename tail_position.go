@@ -0,0 +1,140 @@
+package yamon
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// TailPosition is the offset into a specific file (identified by its inode) up
+// to which lines have been read.
+type TailPosition struct {
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+	// identifies the file by its first bytes, so it can be found again once
+	// it has been rotated and compressed
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+type TailPositionStore interface {
+	Get(path string) (TailPosition, bool)
+	Set(path string, position TailPosition)
+	Delete(path string)
+}
+
+type NoopTailPositionStore struct {
+}
+
+func (n *NoopTailPositionStore) Get(path string) (TailPosition, bool) {
+	return TailPosition{}, false
+}
+
+func (n *NoopTailPositionStore) Set(path string, position TailPosition) {}
+
+func (n *NoopTailPositionStore) Delete(path string) {}
+
+// FileBasedTailPositionStore keeps positions in memory and periodically writes
+// them to a JSON file.
+type FileBasedTailPositionStore struct {
+	sync.Mutex
+
+	path      string
+	interval  time.Duration
+	positions map[string]TailPosition
+	dirty     bool
+}
+
+func NewFileBasedTailPositionStore(path string, interval time.Duration) (*FileBasedTailPositionStore, error) {
+	store := &FileBasedTailPositionStore{
+		path:      path,
+		interval:  interval,
+		positions: map[string]TailPosition{},
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if len(data) > 0 {
+		err = json.Unmarshal(data, &store.positions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return store, nil
+}
+
+func (f *FileBasedTailPositionStore) Get(path string) (TailPosition, bool) {
+	f.Lock()
+	defer f.Unlock()
+	position, ok := f.positions[path]
+	return position, ok
+}
+
+func (f *FileBasedTailPositionStore) Set(path string, position TailPosition) {
+	f.Lock()
+	f.positions[path] = position
+	f.dirty = true
+	f.Unlock()
+}
+
+func (f *FileBasedTailPositionStore) Delete(path string) {
+	f.Lock()
+	delete(f.positions, path)
+	f.dirty = true
+	f.Unlock()
+}
+
+// Sync writes the positions to disk if they have changed
+func (f *FileBasedTailPositionStore) Sync() error {
+	f.Lock()
+	if !f.dirty {
+		f.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(f.positions)
+	f.dirty = false
+	f.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// write + rename so a crash never leaves a truncated file behind
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path)
+}
+
+func (f *FileBasedTailPositionStore) Run() {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := f.Sync()
+		if err != nil {
+			slog.Error("failed to sync tail positions", slog.String("path", f.path), slog.Any("error", err))
+		}
+	}
+}
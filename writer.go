@@ -40,7 +40,10 @@ func (s *SinkMetadataFilter) WriteLog(log *common.LogEntry) {
 			log.Tags[k] = v
 		}
 	}
-	log.Host = s.hostname
+	// entries received from other machines (e.g. via syslog) keep their host
+	if !log.Relayed || log.Host == "" {
+		log.Host = s.hostname
+	}
 	s.sink.WriteLog(log)
 }
 
@@ -53,3 +56,44 @@ func (s *SinkMetadataFilter) WriteEvent(event *common.Event) {
 	event.Host = s.hostname
 	s.sink.WriteEvent(event)
 }
+
+// SinkTagFilter adds a fixed set of tags to everything written through it
+type SinkTagFilter struct {
+	tags map[string]string
+	sink common.Sink
+}
+
+func NewSinkTagFilter(tags map[string]string, sink common.Sink) *SinkTagFilter {
+	return &SinkTagFilter{
+		tags: tags,
+		sink: sink,
+	}
+}
+
+// apply returns a copy of tags with the filter's tags merged in, the original
+// map may be reused by the caller for later writes
+func (s *SinkTagFilter) apply(tags map[string]string) map[string]string {
+	result := make(map[string]string, len(tags)+len(s.tags))
+	for k, v := range tags {
+		result[k] = v
+	}
+	for k, v := range s.tags {
+		result[k] = v
+	}
+	return result
+}
+
+func (s *SinkTagFilter) WriteMetric(metric *common.Metric) {
+	metric.Tags = s.apply(metric.Tags)
+	s.sink.WriteMetric(metric)
+}
+
+func (s *SinkTagFilter) WriteLog(log *common.LogEntry) {
+	log.Tags = s.apply(log.Tags)
+	s.sink.WriteLog(log)
+}
+
+func (s *SinkTagFilter) WriteEvent(event *common.Event) {
+	event.Tags = s.apply(event.Tags)
+	s.sink.WriteEvent(event)
+}